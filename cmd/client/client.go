@@ -21,6 +21,7 @@ import (
 	"os/signal"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type State struct {
@@ -46,6 +47,10 @@ const (
 
 	// Time to wait before force close on connection.
 	closeGracePeriod = 10 * time.Second
+
+	// Stops reading keys. Ctrl+C reaches the client as a key in raw mode, and
+	// unlike letters it is never bound to a cell.
+	quitKey = '\x03'
 )
 
 func readFromStdin(ws *websocket.Conn, in chan string, done chan struct{}, state *State) {
@@ -74,15 +79,13 @@ func readFromStdin(ws *websocket.Conn, in chan string, done chan struct{}, state
 	ws.Close()
 }
 
-func drawGameBoard(board [3][3]int) string {
+func drawGameBoard(board [][]int) string {
 	gameStr := []string{}
 	for _, row := range board {
 		drawRow := []string{}
 		for _, cell := range row {
-			if cell == 1 {
-				drawRow = append(drawRow, " M ")
-			} else if cell == 2 {
-				drawRow = append(drawRow, " R ")
+			if targetType, ok := internal.TargetTypeOf(cell); ok {
+				drawRow = append(drawRow, " "+strings.ToUpper(targetType.Marker)+" ")
 			} else {
 				drawRow = append(drawRow, "   ")
 			}
@@ -90,7 +93,54 @@ func drawGameBoard(board [3][3]int) string {
 		}
 		gameStr = append(gameStr, "|"+strings.Join(drawRow, "|")+"|")
 	}
-	return "-------------\r\n" + strings.Join(gameStr, "\r\n-------------\r\n") + "\r\n-------------\r\n"
+	if len(board) == 0 {
+		return ""
+	}
+	separator := strings.Repeat("-", len(board[0])*4+1)
+	return separator + "\r\n" + strings.Join(gameStr, "\r\n"+separator+"\r\n") + "\r\n" + separator + "\r\n"
+}
+
+func drawGameResult(result internal.GameResult) string {
+	lines := []string{fmt.Sprintf("Game over (%s). Winner: %s. Seed: %d", result.Reason, result.Winner, result.Seed)}
+	for _, p := range result.Standings {
+		lines = append(lines, fmt.Sprintf("#%d %s score: %d health: %d hits: %d rabbits: %d best streak: %d", p.Rank, p.Id, p.Score, p.Health, p.Hits, p.RabbitHits, p.BestStreak))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func readKeys(ws *websocket.Conn) {
+	log.Println("Do something")
+	// fd 0 is stdin
+	state, err := term.MakeRaw(0)
+	if err != nil {
+		log.Fatalln("setting stdin to raw:", err)
+	}
+	defer func() {
+		if err := term.Restore(0, state); err != nil {
+			log.Println("warning, failed to restore terminal:", err)
+		}
+	}()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			log.Println("stdin:", err)
+			break
+		}
+		if r == quitKey {
+			break
+		}
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(string(r))); err != nil {
+			fmt.Println("Error writing to server")
+			ws.Close()
+			break
+		}
+		fmt.Printf("read rune %q\r\n", r)
+	}
 }
 
 func main() {
@@ -116,53 +166,38 @@ func main() {
 		defer close(done)
 		for {
 			_, message, err := c.ReadMessage()
-			var dat internal.GameBoard
-			jsonErr := json.Unmarshal(message, &dat)
-			if jsonErr == nil {
-				fmt.Print("\033[2J")
-				fmt.Print("\033[H")
-				fmt.Print(drawGameBoard(dat.Board))
-			}
-			if string(message) == "Game started" {
-				state.Game = internal.Running
-				go func(ws *websocket.Conn) {
-					log.Println("Do something")
-					// fd 0 is stdin
-					state, err := term.MakeRaw(0)
-					if err != nil {
-						log.Fatalln("setting stdin to raw:", err)
-					}
-					defer func() {
-						if err := term.Restore(0, state); err != nil {
-							log.Println("warning, failed to restore terminal:", err)
-						}
-					}()
-
-					in := bufio.NewReader(os.Stdin)
-					for {
-						r, _, err := in.ReadRune()
-						if err != nil {
-							log.Println("stdin:", err)
-							break
-						}
-						if err := ws.WriteMessage(websocket.TextMessage, []byte(string(r))); err != nil {
-							fmt.Println("Error writing to server")
-							ws.Close()
-							break
-						}
-						fmt.Printf("read rune %q\r\n", r)
-						if r == 'q' {
-							break
-						}
-					}
-				}(c)
-			}
 			if err != nil {
 				log.Println("[error]:", err)
 				return
 			}
-			if !strings.HasPrefix(string(message), "Game Update") && jsonErr != nil {
+			var envelope internal.Envelope
+			if err := json.Unmarshal(message, &envelope); err != nil {
 				log.Printf("[server]: %s", message)
+				continue
+			}
+			if envelope.Version > internal.ProtocolVersion {
+				log.Printf("[warning]: server protocol v%d is newer than client v%d", envelope.Version, internal.ProtocolVersion)
+			}
+			switch envelope.Type {
+			case internal.MessageBoard:
+				var dat internal.GameBoard
+				if err := json.Unmarshal(envelope.Payload, &dat); err == nil {
+					fmt.Print("\033[2J")
+					fmt.Print("\033[H")
+					fmt.Print(drawGameBoard(dat.Board))
+				}
+			case internal.MessageResult:
+				var result internal.GameResult
+				if err := json.Unmarshal(envelope.Payload, &result); err == nil {
+					fmt.Print(drawGameResult(result))
+				}
+			case internal.MessageGameStarted:
+				state.Game = internal.Running
+				go readKeys(c)
+			case internal.MessageSpawn, internal.MessageDespawn:
+				// The board pushed right after redraws the targets
+			default:
+				log.Printf("[server]: %s %s", envelope.Type, envelope.Payload)
 			}
 		}
 	}()
@@ -12,7 +12,6 @@ import (
 	"flag"
 	"github.com/gorilla/websocket"
 	"github.com/tsoonjin/wackamole/internal"
-	"golang.org/x/exp/maps"
 	"log"
 	"net/http"
 	"os"
@@ -20,10 +19,12 @@ import (
 	"strconv"
 )
 
-var rooms = make(map[string]*internal.Game)
+var rooms = internal.NewRooms()
 var sessions = make(map[string]internal.Session)
 
 var addr = flag.String("addr", "localhost:8080", "http service address")
+var finishedAfter = flag.Duration("finished-after", internal.DefaultRoomLifecycle.FinishedAfter, "how long finished rooms stay up")
+var abandonedAfter = flag.Duration("abandoned-after", internal.DefaultRoomLifecycle.AbandonedAfter, "how long rooms stay up once everyone left")
 
 var upgrader = websocket.Upgrader{} // use default options
 
@@ -38,38 +39,82 @@ func handleConnect(interupt chan os.Signal) http.HandlerFunc {
 			log.Print("upgrade:", err)
 			return
 		}
-		go session.Run(interupt, &rooms)
+		go session.Run(interupt, rooms)
 	}
 }
 
 func handleListRoom(w http.ResponseWriter, r *http.Request) {
 	var (
-		res      []*internal.Game
+		res      = []internal.GameRoomStream{}
+		roomList = rooms.Public()
 		startIdx = 0
-		endIdx   = len(rooms)
+		endIdx   = len(roomList)
 	)
 	page, _ := strconv.Atoi(r.FormValue("page"))
 	perPage, _ := strconv.Atoi(r.FormValue("limit"))
 
-	if idx := (page - 1) * perPage; idx < len(rooms) {
+	if idx := (page - 1) * perPage; idx < len(roomList) {
 		startIdx = idx
 	}
-	if idx := page * perPage; idx < len(rooms) {
+	if idx := page * perPage; idx < len(roomList) {
 		endIdx = idx
 	}
-	var roomList = maps.Values(rooms)
-	res = roomList[startIdx:endIdx]
+	for _, game := range roomList[startIdx:endIdx] {
+		res = append(res, game.Summary())
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
 }
 
+// createRoomRequest is the body of POST /rooms
+type createRoomRequest struct {
+	Name   string              `json:"name"`
+	Config internal.GameConfig `json:"config"`
+}
+
+func handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+	var req createRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "body must be {\"name\": ..., \"config\": {...}}", http.StatusBadRequest)
+		return
+	}
+	game, created, err := rooms.GetOrCreate(req.Name, func() (*internal.Game, error) {
+		return internal.CreateGameWithConfig(req.Name, req.Config, nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !created {
+		http.Error(w, "room already exists", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(game.Summary())
+}
+
+func handleRooms(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleListRoom(w, r)
+	case http.MethodPost:
+		handleCreateRoom(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 	flag.Parse()
 	log.SetFlags(0)
+	lifecycle := internal.DefaultRoomLifecycle
+	lifecycle.FinishedAfter, lifecycle.AbandonedAfter = *finishedAfter, *abandonedAfter
+	go rooms.Manage(lifecycle, nil)
 	http.HandleFunc("/connect", handleConnect(interrupt))
-	http.HandleFunc("/rooms", handleListRoom)
+	http.HandleFunc("/rooms", handleRooms)
 	log.Fatal(http.ListenAndServe(*addr, nil))
 }
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"log"
+	"math/big"
+)
+
+// Invite codes leave out letters and digits that are easily mixed up
+const (
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteCodeLength   = 6
+)
+
+// newInviteCode returns a random code for a private room. It does not use the
+// room rng so that codes cannot be guessed from the seed of a match
+func newInviteCode() string {
+	code := make([]byte, inviteCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteCodeAlphabet))))
+		if err != nil {
+			log.Panicf("Cannot generate invite code: %v", err)
+		}
+		code[i] = inviteCodeAlphabet[n.Int64()]
+	}
+	return string(code)
+}
+
+// setAccess makes the room public or private, leaving it as it is when
+// private is nil. A private room keeps its password unless a new one is
+// given, and gets an invite code the first time it turns private
+func (g *Game) setAccess(private *bool, password string) {
+	if private != nil {
+		g.private = *private
+	}
+	if !g.private {
+		g.password, g.inviteCode = "", ""
+		return
+	}
+	if password != "" {
+		g.password = password
+	}
+	if g.inviteCode == "" {
+		g.inviteCode = newInviteCode()
+	}
+}
+
+// admits checks the password or invite code of a player joining the room
+func (g *Game) admits(credential string) bool {
+	if !g.private {
+		return true
+	}
+	return matches(credential, g.password) || matches(credential, g.inviteCode)
+}
+
+func matches(credential string, secret string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(secret)) == 1
+}
+
+// IsPrivate reports whether the room is hidden from room listings
+func (g *Game) IsPrivate() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.private
+}
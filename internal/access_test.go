@@ -0,0 +1,85 @@
+package internal
+
+import "testing"
+
+func TestPrivateRoomCredentials(t *testing.T) {
+	t.Parallel()
+	config := DefaultGameConfig()
+	config.MaxPlayers = 4
+	config.Password = "hunter2"
+	game := newGame("den", config.normalize(), []string{}, []*Session{})
+	summary := game.Summary()
+	if !summary.IsPrivate || summary.InviteCode == "" {
+		t.Fatalf("want a private room with an invite code, got %+v", summary)
+	}
+	if summary.Config.Password != "" {
+		t.Errorf("want the password left out of the summary")
+	}
+	for _, credential := range []string{"", "hunter3"} {
+		if err := game.AddPlayer("mallory", &Session{Id: "mallory"}, credential); err != ErrorWrongCredentials {
+			t.Errorf("%q: want %v, got %v", credential, ErrorWrongCredentials, err)
+		}
+	}
+	for _, id := range []string{"alice", "bob"} {
+		credential := "hunter2"
+		if id == "bob" {
+			credential = summary.InviteCode
+		}
+		if err := game.AddPlayer(id, &Session{Id: id, out: make(chan []byte, 32)}, credential); err != nil {
+			t.Errorf("%s: want no error, got %v", id, err)
+		}
+	}
+
+	// A new config keeps the room private unless the host turns it public
+	if err := game.SetConfig("alice", GameConfig{DurationMs: 30000, MaxPlayers: 4}); err != nil {
+		t.Fatalf("want config changed, got %v", err)
+	}
+	if !game.IsPrivate() || game.Summary().InviteCode != summary.InviteCode {
+		t.Errorf("want the room still private with the same invite code")
+	}
+	if err := game.AddPlayer("mallory", &Session{Id: "mallory"}, "hunter3"); err != ErrorWrongCredentials {
+		t.Errorf("want %v after the config change, got %v", ErrorWrongCredentials, err)
+	}
+	if err := game.AddPlayer("carol", &Session{Id: "carol", out: make(chan []byte, 32)}, "hunter2"); err != nil {
+		t.Errorf("want the password kept, got %v", err)
+	}
+	public := false
+	game.SetConfig("alice", GameConfig{MaxPlayers: 4, Private: &public})
+	if game.IsPrivate() || game.Summary().InviteCode != "" {
+		t.Errorf("want no invite code for a public room")
+	}
+	if err := game.AddPlayer("dave", &Session{Id: "dave", out: make(chan []byte, 32)}, ""); err != nil {
+		t.Errorf("want anyone let into a public room, got %v", err)
+	}
+}
+
+func TestPrivateRoomsAreNotListed(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	for _, name := range []string{"den", "park"} {
+		config := DefaultGameConfig()
+		private := name == "den"
+		config.Private = &private
+		rooms.GetOrCreate(name, func() (*Game, error) {
+			return newGame(name, config, []string{}, []*Session{}), nil
+		})
+	}
+	public := rooms.Public()
+	if len(public) != 1 || public[0].Id != "park" {
+		t.Errorf("want only park listed, got %d rooms", len(public))
+	}
+
+	session := &Session{Id: "mallory", rooms: rooms, out: make(chan []byte, 32)}
+	socketRequest, err := session.parseCommand("/join den letmein")
+	if got := newErrorMessage(socketRequest.Command, err).Code; got != ErrorCodeWrongCredentials {
+		t.Errorf("want code %s, got %s", ErrorCodeWrongCredentials, got)
+	}
+
+	if _, err := session.parseCommand("/join lair letmein"); err != nil {
+		t.Fatalf("want lair created, got %v", err)
+	}
+	lair, _ := rooms.Get("lair")
+	if !lair.IsPrivate() || lair.AddPlayer("eve", &Session{Id: "eve"}, "") != ErrorWrongCredentials {
+		t.Errorf("want lair protected by the password it was created with")
+	}
+}
@@ -2,61 +2,86 @@ package internal
 
 // Manages incoming connections
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/cip8/autoname"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"log"
 	"os"
-	"strings"
 	"time"
 )
 
 var channel_buffer int = 256
 
-var clientKeyMap = map[int]string{
-	0: "w",
-	1: "e",
-	2: "r",
-	3: "s",
-	4: "d",
-	5: "f",
-	6: "x",
-	7: "c",
-	8: "v",
-}
-
-type Command interface {
-	execute()
-}
-
 type Session struct {
 	Id   string
 	Name string
 	conn *websocket.Conn
-	in   chan []byte
+	in   chan inbound
 	out  chan []byte
 	room *Game
+	// Rooms known to the server, shared by every session
+	rooms *Rooms
+	// Sequence number of the last message sent to the client
+	seq uint64
+	// Id of the request being handled, only touched by the session goroutine
+	requestId string
+	// When the request being handled was read off the socket
+	receivedAt time.Time
+}
+
+// inbound is a message read from the client along with the time it arrived
+type inbound struct {
+	msg        []byte
+	receivedAt time.Time
 }
 
 type SocketPayload struct {
 	Name     string `json:"name"`
 	RoomName string `json:"roomName"`
-	Hit      int    `json:"hit"`
+	// Index of the cell being hit
+	Hit *int `json:"hit,omitempty"`
+	// Key of the cell being hit, takes precedence over Hit when set
+	Key string `json:"key"`
+	// Board size of a room created by connect or join, 3x3 when not set
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+	// Spawn policy of a room created by connect or join, one mole and one
+	// rabbit per round when not set
+	Spawn *SpawnPolicy `json:"spawn,omitempty"`
+	// Seed of a room created by connect or join, replays a previous match.
+	// Only accepted by debug builds
+	Seed int64 `json:"seed,omitempty"`
+	// Settings of a room created by connect or join, Rows, Cols and Spawn
+	// take precedence when set
+	Config *GameConfig `json:"config,omitempty"`
+	// Player targeted by kick
+	Player string `json:"player,omitempty"`
+	// Password or invite code of the private room being joined, or password
+	// of the room created by connect or join
+	Password string `json:"password,omitempty"`
 }
 
 type SocketRequest struct {
 	Command string        `json:"command"`
 	Payload SocketPayload `json:"payload"`
+	// Optional id chosen by the client, echoed on the reply to this request
+	RequestId string `json:"requestId,omitempty"`
 }
 
 type GameRoomStream struct {
-	Name           string   `json:"name"`
-	IsPrivate      bool     `json:"isPrivate"`
-	State          string   `json:"state"`
-	ReadyPlayers   []string `json:"readyPlayers"`
-	WaitingPlayers []string `json:"waitingPlayers"`
+	Name string `json:"name"`
+	// Player who runs the room
+	Host      string `json:"host"`
+	Locked    bool   `json:"locked"`
+	IsPrivate bool   `json:"isPrivate"`
+	// Code that lets players into a private room. Private rooms are never
+	// listed, so only their players and whoever created them see it
+	InviteCode     string     `json:"inviteCode,omitempty"`
+	State          string     `json:"state"`
+	ReadyPlayers   []string   `json:"readyPlayers"`
+	WaitingPlayers []string   `json:"waitingPlayers"`
+	Config         GameConfig `json:"config"`
 }
 
 func InitSession(conn *websocket.Conn) Session {
@@ -64,7 +89,7 @@ func InitSession(conn *websocket.Conn) Session {
 		Id:   uuid.New().String(),
 		Name: autoname.Generate(""),
 		conn: conn,
-		in:   make(chan []byte, channel_buffer),
+		in:   make(chan inbound, channel_buffer),
 		out:  make(chan []byte, channel_buffer),
 	}
 }
@@ -72,153 +97,70 @@ func InitSession(conn *websocket.Conn) Session {
 // Allow user to reconnect to existing session
 func (s *Session) Reconnect(conn *websocket.Conn) {
 	s.conn = conn
-	s.in = make(chan []byte)
-	s.out = make(chan []byte)
+	s.in = make(chan inbound, channel_buffer)
+	s.out = make(chan []byte, channel_buffer)
 }
 
-func (s *Session) parseCommand(msg string, rooms *map[string]*Game) {
-	socketRequest := SocketRequest{}
-	json.Unmarshal([]byte(msg), &socketRequest)
+// parseCommand runs the command in msg and returns the parsed request along
+// with the reason it was rejected, if any
+func (s *Session) parseCommand(msg string) (SocketRequest, error) {
+	socketRequest, err := parseRequest(msg)
+	s.requestId = socketRequest.RequestId
+	if err != nil {
+		return socketRequest, err
+	}
 	log.Println("Parsed", socketRequest)
-	splittedMsg := strings.Split(msg, " ")
-	command := strings.TrimRight(splittedMsg[0], "\n")
-	args := splittedMsg[1:]
-	switch socketRequest.Command {
-	case "init":
-		runningState := GameState{"running"}
-		if s.room.state != runningState {
-			s.room.AddPlayer("Bob", s)
-			s.room.AddPlayer("Alice", s)
-			s.room.state = GameState{"running"}
-			newBoard := s.room.initGameBoard()
-			s.room.board = newBoard
-			s.room.startTime = time.Now()
-		}
-	case "send":
-		runningState := GameState{"running"}
-		if s.room.state != runningState {
-			s.room.AddPlayer("Bob", s)
-			s.room.AddPlayer("Alice", s)
-			s.room.state = GameState{"running"}
-			newBoard := s.room.initGameBoard()
-			s.room.board = newBoard
-			s.room.startTime = time.Now()
-		}
-		s.room.AddAction(time.Now().Unix(), "Bob", clientKeyMap[socketRequest.Payload.Hit])
-	case "connect":
-		s.Name = socketRequest.Payload.Name
-		log.Println("Session name set to: ", s.Name)
-		if s.room == nil {
-			newGame, err := CreateGameV2(s.Name, 2, 2, []string{s.Id}, time.NewTicker(time.Second), []*Session{s})
-			if err != nil {
-				s.out <- []byte("Failed to create a new game room")
-			}
-			log.Printf("New game room created: %s", s.Name)
-			(*rooms)[s.Name] = newGame
-			s.room = newGame
-		}
-		go func() {
-			players := []string{"Joe", "Nick", "Nikki", "Brand"}
-			for i := 0; i < 4; i++ {
-				time.Sleep(5 * time.Second)
-				readyPlayers := players[:i+1]
-				waitingPlayers := players[i+1:]
-				var gameState = "WAITING"
-				if len(readyPlayers) == len(players) {
-					gameState = "READY"
-				}
-				for _, s := range s.room.sessions {
-					payload, _ := json.Marshal(GameRoomStream{
-						Name:           fmt.Sprintf("%s Room", s.room.Id),
-						IsPrivate:      false,
-						State:          gameState,
-						ReadyPlayers:   readyPlayers,
-						WaitingPlayers: waitingPlayers,
-					})
-					s.out <- []byte(payload)
-				}
-
-			}
-		}()
-		return
-	case "join":
-		roomName := socketRequest.Payload.RoomName
-		log.Printf("Player %s wants to join a game, %s", s.Name, roomName)
-		if s.room != nil {
-			log.Printf("Player %s unable to join a game till current game is over", s.Name)
-		}
-		if game, ok := (*rooms)[roomName]; ok {
-			s.room = game
-			game.AddPlayer(s.Id, s)
-			return
-		}
-		newGame, err := CreateGameV2(roomName, 2, 2, []string{s.Id}, time.NewTicker(time.Second), []*Session{s})
-		if err != nil {
-			s.out <- []byte("Failed to create a new game room")
-		}
-		log.Printf("New game room created: %s", roomName)
-		(*rooms)[roomName] = newGame
-		s.room = newGame
+	cmd, ok := commands[socketRequest.Command]
+	if !ok {
+		return socketRequest, fmt.Errorf("%w %q", ErrorUnknownCommand, socketRequest.Command)
 	}
-
-	switch command {
-	case "/join":
-		roomName := args[0]
-		log.Printf("Player %s wants to join a game, %s", s.Name, roomName)
-		if s.room != nil {
-			log.Printf("Player %s unable to join a game till current game is over", s.Name)
-		}
-		if game, ok := (*rooms)[roomName]; ok {
-			s.room = game
-			game.AddPlayer(s.Id, s)
-			return
-		}
-		newGame, err := CreateGameV2(roomName, 2, 2, []string{s.Id}, time.NewTicker(time.Second), []*Session{s})
-		if err != nil {
-			s.out <- []byte("Failed to create a new game room")
-		}
-		log.Printf("New game room created: %s", roomName)
-		(*rooms)[roomName] = newGame
-		s.room = newGame
-	case "/ready":
-		log.Printf("Player %s is ready to rumble in %s", s.Name, s.room.Id)
-		s.room.AddPlayerReady(s.Id)
-	default:
-		if s.room.state == Running {
-			log.Printf("Recv %s, %s", s.Id, msg)
-			s.room.AddAction(time.Now().Unix(), s.Id, msg)
-		}
-
+	if err := cmd.Validate(socketRequest.Payload); err != nil {
+		return socketRequest, err
 	}
+	return socketRequest, cmd.Execute(s, socketRequest.Payload)
 }
 
-func (s *Session) Run(interupt chan os.Signal, rooms *map[string]*Game) {
+func (s *Session) Run(interupt chan os.Signal, rooms *Rooms) {
+	s.rooms = rooms
+	disconnected := make(chan struct{})
 	// Handle socket connection with client
 	go func() {
+		defer close(disconnected)
 		defer s.conn.Close()
 		for {
 			_, message, err := s.conn.ReadMessage()
+			receivedAt := time.Now()
 			log.Println("Message from someone", string(message))
 			if err != nil {
 				log.Println("Error reading message from socket conn: ", err)
 				return
 			}
-			s.in <- message
+			s.in <- inbound{msg: message, receivedAt: receivedAt}
 		}
 	}()
 
 	for {
 		select {
 		case msgFromClient := <-s.in:
-			log.Printf("%s <<: %s", s.Name, string(msgFromClient))
-			s.parseCommand(string(msgFromClient), rooms)
-			s.out <- []byte("Acked")
+			log.Printf("%s <<: %s", s.Name, string(msgFromClient.msg))
+			s.receivedAt = msgFromClient.receivedAt
+			socketRequest, err := s.parseCommand(string(msgFromClient.msg))
+			if err != nil {
+				log.Printf("%s command rejected: %v", s.Name, err)
+				s.reply(MessageError, newErrorMessage(socketRequest.Command, err))
+				continue
+			}
+			s.reply(MessageAck, AckMessage{})
 
 		case msgToClient := <-s.out:
 			if err := s.conn.WriteMessage(websocket.TextMessage, msgToClient); err != nil {
 				log.Println("Error writing to client")
 			}
 
+		case <-disconnected:
+			s.leaveRoom()
+			return
+
 		case <-interupt:
 			log.Println("Interupted by user")
 			err := s.conn.WriteMessage(websocket.CloseMessage,
@@ -231,3 +173,13 @@ func (s *Session) Run(interupt chan os.Signal, rooms *map[string]*Game) {
 		}
 	}
 }
+
+// leaveRoom takes the player out of their room once the connection is gone,
+// leaving a running game forfeits it
+func (s *Session) leaveRoom() {
+	if room, err := s.currentRoom(); err == nil {
+		log.Printf("Player %s disconnected from %s", s.Name, room.Id)
+		room.RemovePlayer(s.Id)
+		s.room = nil
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import "fmt"
+
+const (
+	defaultBoardRows = 3
+	defaultBoardCols = 3
+)
+
+// Boards taller than the four rows of the keyboard go on with the same keys
+// shifted, so every cell is a single key press
+var keyboardRows = []string{
+	"1234567890", "qwertyuiop", "asdfghjkl;", "zxcvbnm,./",
+	"!@#$%^&*()", "QWERTYUIOP", "ASDFGHJKL:", "ZXCVBNM<>?",
+}
+
+// Largest board that keyLayout can give a key to every cell of
+var (
+	maxBoardRows = len(keyboardRows)
+	maxBoardCols = len(keyboardRows[0])
+)
+
+// keyLayout assigns a key to every cell, row by row, keeping the shape of
+// the board. The default 3x3 board maps onto w e r / s d f / x c v
+func keyLayout(rows int, cols int) []string {
+	keys := make([]string, 0, rows*cols)
+	rowOffset, colOffset := 0, 0
+	// Boards shorter than the unshifted keyboard leave out the number row
+	if rows < 4 {
+		rowOffset = 1
+	}
+	if cols < maxBoardCols {
+		colOffset = 1
+	}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			keys = append(keys, string(keyboardRows[r+rowOffset][c+colOffset]))
+		}
+	}
+	return keys
+}
+
+func validateBoardSize(rows int, cols int) error {
+	if rows < 1 || cols < 1 || rows > maxBoardRows || cols > maxBoardCols {
+		return fmt.Errorf("%w: board must be between 1x1 and %dx%d", ErrorInvalidArguments, maxBoardRows, maxBoardCols)
+	}
+	if rows*cols < 2 {
+		return fmt.Errorf("%w: board needs room for a mole and a rabbit", ErrorInvalidArguments)
+	}
+	return nil
+}
+
+func emptyBoard(rows int, cols int) ([][]int, []string) {
+	board := make([][]int, rows)
+	for r := range board {
+		board[r] = make([]int, cols)
+	}
+	return board, make([]string, rows*cols)
+}
+
+// cellOf returns the position of the cell bound to key
+func (g *Game) cellOf(key string) (int, int, bool) {
+	for i, k := range g.keys {
+		if k == key {
+			return i / g.cols, i % g.cols, true
+		}
+	}
+	return 0, 0, false
+}
+
+// KeyAt returns the key bound to the cell at index
+func (g *Game) KeyAt(index int) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if index < 0 || index >= len(g.keys) {
+		return "", fmt.Errorf("%w: cell %d is not on the board", ErrorInvalidArguments, index)
+	}
+	return g.keys[index], nil
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyLayout(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		rows, cols int
+		want       []string
+	}{
+		{3, 3, []string{"w", "e", "r", "s", "d", "f", "x", "c", "v"}},
+		{4, 2, []string{"2", "3", "w", "e", "s", "d", "x", "c"}},
+		{5, 1, []string{"2", "w", "s", "x", "@"}},
+	}
+	for _, c := range cases {
+		if got := keyLayout(c.rows, c.cols); !reflect.DeepEqual(c.want, got) {
+			t.Errorf("%dx%d: want %v, got %v", c.rows, c.cols, c.want, got)
+		}
+	}
+	seen := map[string]bool{}
+	for _, key := range keyLayout(maxBoardRows, maxBoardCols) {
+		if len(key) != 1 || seen[key] {
+			t.Errorf("want a distinct single key per cell, got %q", key)
+		}
+		seen[key] = true
+	}
+}
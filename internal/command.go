@@ -0,0 +1,417 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Command handles a single kind of client request. The same command can be
+// sent as JSON, {"command": "join", "payload": {"roomName": "lobby"}}, or with
+// the slash syntax used by the terminal client, /join lobby
+type Command interface {
+	// Parse maps the arguments of the slash syntax onto a payload
+	Parse(args []string) (SocketPayload, error)
+	// Validate rejects a payload before the command is executed
+	Validate(payload SocketPayload) error
+	// Execute runs the command on behalf of the session
+	Execute(s *Session, payload SocketPayload) error
+}
+
+var commands = map[string]Command{}
+
+// RegisterCommand makes a command available under the given name. Registering
+// the same name twice replaces the previous command
+func RegisterCommand(name string, cmd Command) {
+	commands[name] = cmd
+}
+
+// commandHandler builds a Command out of plain functions. parse and validate
+// are optional
+type commandHandler struct {
+	parse    func(args []string) (SocketPayload, error)
+	validate func(payload SocketPayload) error
+	execute  func(s *Session, payload SocketPayload) error
+}
+
+func (c commandHandler) Parse(args []string) (SocketPayload, error) {
+	if c.parse == nil {
+		return SocketPayload{}, nil
+	}
+	return c.parse(args)
+}
+
+func (c commandHandler) Validate(payload SocketPayload) error {
+	if c.validate == nil {
+		return nil
+	}
+	return c.validate(payload)
+}
+
+func (c commandHandler) Execute(s *Session, payload SocketPayload) error {
+	return c.execute(s, payload)
+}
+
+func init() {
+	RegisterCommand("connect", commandHandler{parse: parseConnect, validate: validateConnect, execute: executeConnect})
+	RegisterCommand("join", commandHandler{parse: parseJoin, validate: validateJoin, execute: executeJoin})
+	RegisterCommand("ready", commandHandler{execute: executeReady})
+	RegisterCommand("hit", commandHandler{parse: parseHit, validate: validateHit, execute: executeHit})
+	RegisterCommand("leave", commandHandler{execute: executeLeave})
+	RegisterCommand("unready", commandHandler{execute: executeUnready})
+	RegisterCommand("kick", commandHandler{parse: parseKick, validate: validateKick, execute: executeKick})
+	RegisterCommand("config", commandHandler{parse: parseConfig, validate: validateConfig, execute: executeConfig})
+	RegisterCommand("lock", commandHandler{execute: executeLock(true)})
+	RegisterCommand("unlock", commandHandler{execute: executeLock(false)})
+	RegisterCommand("start", commandHandler{execute: executeStart})
+	RegisterCommand("close", commandHandler{execute: executeClose})
+	RegisterCommand("list", commandHandler{execute: executeList})
+}
+
+// parseRequest turns a raw message into a request. JSON and slash commands
+// are mapped onto the same request, anything else is treated as a key press
+// from the terminal client. Blank messages are hits without a key, rejected
+// by validateHit. A lone slash is the key of a cell on the widest boards
+func parseRequest(msg string) (SocketRequest, error) {
+	trimmed := strings.TrimSpace(msg)
+	if strings.HasPrefix(trimmed, "{") {
+		socketRequest := SocketRequest{}
+		if err := json.Unmarshal([]byte(trimmed), &socketRequest); err != nil {
+			return socketRequest, fmt.Errorf("%w: %v", ErrorMalformedRequest, err)
+		}
+		return socketRequest, nil
+	}
+	if strings.HasPrefix(trimmed, "/") && trimmed != "/" {
+		fields := strings.Fields(trimmed)
+		name := strings.TrimPrefix(fields[0], "/")
+		cmd, ok := commands[name]
+		if !ok {
+			return SocketRequest{Command: name}, nil
+		}
+		payload, err := cmd.Parse(fields[1:])
+		return SocketRequest{Command: name, Payload: payload}, err
+	}
+	return SocketRequest{Command: "hit", Payload: SocketPayload{Key: trimmed}}, nil
+}
+
+func expectArgs(args []string, usage string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w, usage: %s", ErrorInvalidArguments, usage)
+	}
+	return nil
+}
+
+func parseConnect(args []string) (SocketPayload, error) {
+	if err := expectArgs(args, "/connect <name>"); err != nil {
+		return SocketPayload{}, err
+	}
+	return SocketPayload{Name: args[0]}, nil
+}
+
+func validateConnect(payload SocketPayload) error {
+	if payload.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrorInvalidArguments)
+	}
+	_, err := roomConfig(payload)
+	return err
+}
+
+// Whether clients may pick the seed of the rooms they create. A known seed
+// gives away where every target spawns, so only debug builds replay matches
+var acceptSeeds = false
+
+// roomConfig returns the validated settings requested for a new room. A
+// password protects the new room like Config.Password does
+func roomConfig(payload SocketPayload) (GameConfig, error) {
+	if payload.Seed != 0 && !acceptSeeds {
+		return GameConfig{}, fmt.Errorf("%w: seeds are only accepted by debug builds", ErrorInvalidArguments)
+	}
+	config := GameConfig{}
+	if payload.Config != nil {
+		config = *payload.Config
+	}
+	if payload.Rows != 0 || payload.Cols != 0 {
+		config.Rows, config.Cols = payload.Rows, payload.Cols
+	}
+	if payload.Spawn != nil {
+		config.Spawn = *payload.Spawn
+	}
+	if payload.Password != "" {
+		config.Password = payload.Password
+	}
+	config = config.normalize()
+	return config, config.validate()
+}
+
+func executeConnect(s *Session, payload SocketPayload) error {
+	s.Name = payload.Name
+	log.Println("Session name set to: ", s.Name)
+	if s.room == nil {
+		return joinRoom(s, s.Name, payload)
+	}
+	return nil
+}
+
+// parseJoin accepts an optional board size for new rooms and the password or
+// invite code of private rooms, /join lobby 4x5 or /join lobby K7PX2Q
+func parseJoin(args []string) (SocketPayload, error) {
+	usage := fmt.Errorf("%w, usage: /join <room> [rowsxcols] [password]", ErrorInvalidArguments)
+	if len(args) == 0 || len(args) > 3 {
+		return SocketPayload{}, usage
+	}
+	payload := SocketPayload{RoomName: args[0]}
+	rest := args[1:]
+	if len(rest) > 0 {
+		var rows, cols int
+		if _, err := fmt.Sscanf(rest[0], "%dx%d", &rows, &cols); err == nil {
+			payload.Rows, payload.Cols = rows, cols
+			rest = rest[1:]
+		} else if len(rest) == 2 {
+			return SocketPayload{}, usage
+		}
+	}
+	if len(rest) == 1 {
+		payload.Password = rest[0]
+	}
+	return payload, nil
+}
+
+func validateJoin(payload SocketPayload) error {
+	if payload.RoomName == "" {
+		return fmt.Errorf("%w: roomName is required", ErrorInvalidArguments)
+	}
+	_, err := roomConfig(payload)
+	return err
+}
+
+// executeJoin moves the player to another room, creating it if needed.
+// Players cannot switch rooms in the middle of a game
+func executeJoin(s *Session, payload SocketPayload) error {
+	roomName := payload.RoomName
+	log.Printf("Player %s wants to join a game, %s", s.Name, roomName)
+	room, err := s.currentRoom()
+	if err != nil {
+		return joinRoom(s, roomName, payload)
+	}
+	if room.Id == roomName {
+		return nil
+	}
+	if state := room.State(); state == Running || state == Tiebreak {
+		return ErrorGameInProgress
+	}
+	// The player only leaves once the new room has let them in
+	if err := joinRoom(s, roomName, payload); err != nil {
+		return err
+	}
+	log.Printf("Player %s left %s to join %s", s.Name, room.Id, roomName)
+	room.RemovePlayer(s.Id)
+	return nil
+}
+
+// joinRoom adds the session to the room, creating the room with the config
+// and seed from payload if needed
+func joinRoom(s *Session, roomName string, payload SocketPayload) error {
+	game, created, err := s.rooms.GetOrCreate(roomName, func() (*Game, error) {
+		config, err := roomConfig(payload)
+		if err != nil {
+			return nil, err
+		}
+		newGame, err := CreateGameWithConfig(roomName, config, []*Session{s})
+		if err != nil {
+			return nil, err
+		}
+		if payload.Seed != 0 {
+			if err := newGame.SetSeed(payload.Seed); err != nil {
+				return nil, err
+			}
+		}
+		return newGame, nil
+	})
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("New game room created: %s", roomName)
+	} else if err := game.AddPlayer(s.Id, s, payload.Password); err != nil {
+		return err
+	}
+	s.room = game
+	return nil
+}
+
+// currentRoom returns the room of the session, forgetting it if the player
+// has been kicked out of it
+func (s *Session) currentRoom() (*Game, error) {
+	if s.room != nil && !s.room.HasPlayer(s.Id) {
+		s.room = nil
+	}
+	if s.room == nil {
+		return nil, ErrorNotInRoom
+	}
+	return s.room, nil
+}
+
+func executeReady(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	log.Printf("Player %s is ready to rumble in %s", s.Name, room.Id)
+	room.AddPlayerReady(s.Id)
+	return nil
+}
+
+func executeUnready(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	log.Printf("Player %s is no longer ready in %s", s.Name, room.Id)
+	room.RemovePlayerReady(s.Id)
+	return nil
+}
+
+// parseHit accepts either a cell index, /hit 4, or a key, /hit d
+func parseHit(args []string) (SocketPayload, error) {
+	if err := expectArgs(args, "/hit <cell|key>"); err != nil {
+		return SocketPayload{}, err
+	}
+	if hit, err := strconv.Atoi(args[0]); err == nil {
+		return SocketPayload{Hit: &hit}, nil
+	}
+	return SocketPayload{Key: args[0]}, nil
+}
+
+func validateHit(payload SocketPayload) error {
+	if payload.Key == "" && payload.Hit == nil {
+		return fmt.Errorf("%w: key or hit is required", ErrorInvalidArguments)
+	}
+	if payload.Key == "" && *payload.Hit < 0 {
+		return fmt.Errorf("%w: cell %d is not on the board", ErrorInvalidArguments, *payload.Hit)
+	}
+	return nil
+}
+
+// hitKey returns the key of the cell being hit. Keys depend on the board
+// size so they are only checked once the room is known
+func hitKey(room *Game, payload SocketPayload) (string, error) {
+	if payload.Key != "" {
+		return payload.Key, nil
+	}
+	return room.KeyAt(*payload.Hit)
+}
+
+func executeHit(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	key, err := hitKey(room, payload)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recv %s, %s", s.Id, key)
+	return room.AddAction(s.receivedAt.UnixNano(), s.Id, key)
+}
+
+// executeLeave takes the player out of the room. Leaving a running game
+// forfeits it
+func executeLeave(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	log.Printf("Player %s left %s", s.Name, room.Id)
+	room.RemovePlayer(s.Id)
+	s.room = nil
+	return nil
+}
+
+func parseKick(args []string) (SocketPayload, error) {
+	if err := expectArgs(args, "/kick <player>"); err != nil {
+		return SocketPayload{}, err
+	}
+	return SocketPayload{Player: args[0]}, nil
+}
+
+func validateKick(payload SocketPayload) error {
+	if payload.Player == "" {
+		return fmt.Errorf("%w: player is required", ErrorInvalidArguments)
+	}
+	return nil
+}
+
+func executeKick(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	log.Printf("Player %s kicks %s out of %s", s.Name, payload.Player, room.Id)
+	return room.Kick(s.Id, payload.Player)
+}
+
+func executeList(s *Session, payload SocketPayload) error {
+	rooms := []GameRoomStream{}
+	for _, game := range s.rooms.Public() {
+		rooms = append(rooms, game.Summary())
+	}
+	s.reply(MessageRoomList, RoomListMessage{Rooms: rooms})
+	return nil
+}
+
+// parseConfig accepts the config as JSON, /config {"durationMs": 30000}
+func parseConfig(args []string) (SocketPayload, error) {
+	config := GameConfig{}
+	if err := json.Unmarshal([]byte(strings.Join(args, " ")), &config); err != nil {
+		return SocketPayload{}, fmt.Errorf("%w, usage: /config <json>", ErrorInvalidArguments)
+	}
+	return SocketPayload{Config: &config}, nil
+}
+
+func validateConfig(payload SocketPayload) error {
+	if payload.Config == nil {
+		return fmt.Errorf("%w: config is required", ErrorInvalidArguments)
+	}
+	return nil
+}
+
+func executeConfig(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	return room.SetConfig(s.Id, *payload.Config)
+}
+
+func executeLock(locked bool) func(s *Session, payload SocketPayload) error {
+	return func(s *Session, payload SocketPayload) error {
+		room, err := s.currentRoom()
+		if err != nil {
+			return err
+		}
+		return room.SetLocked(s.Id, locked)
+	}
+}
+
+func executeStart(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	return room.StartCountdown(s.Id)
+}
+
+func executeClose(s *Session, payload SocketPayload) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	if err := room.Close(s.Id); err != nil {
+		return err
+	}
+	s.rooms.Remove(room)
+	s.room = nil
+	return nil
+}
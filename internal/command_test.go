@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRequestSyntaxesAgree(t *testing.T) {
+	t.Parallel()
+	fromJSON, err := parseRequest(`{"command": "join", "payload": {"roomName": "lobby"}}`)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	fromSlash, err := parseRequest("/join lobby\n")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromSlash) {
+		t.Errorf("want %+v, got %+v", fromJSON, fromSlash)
+	}
+}
+
+func TestParseRequestKeyPress(t *testing.T) {
+	t.Parallel()
+	got, _ := parseRequest("d")
+	want := SocketRequest{Command: "hit", Payload: SocketPayload{Key: "d"}}
+	if got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestParseCommandRejections(t *testing.T) {
+	t.Parallel()
+	session := &Session{rooms: NewRooms()}
+	cases := map[string]ErrorCode{
+		"/join":                                 ErrorCodeInvalidArguments,
+		`{"command": "connect", "payload": {}}`: ErrorCodeInvalidArguments,
+		"/hit -1":                               ErrorCodeInvalidArguments,
+		"\r":                                    ErrorCodeInvalidArguments,
+		`{"command": "hit", "payload": {}}`:     ErrorCodeInvalidArguments,
+		"/join lobby 20x20":                     ErrorCodeInvalidArguments,
+		"/join lobby big secret":                ErrorCodeInvalidArguments,
+		"/dance":                                ErrorCodeUnknownCommand,
+		"{not json":                             ErrorCodeMalformedRequest,
+		"/ready":                                ErrorCodeNotInRoom,
+		"/unready":                              ErrorCodeNotInRoom,
+		"/kick":                                 ErrorCodeInvalidArguments,
+		"/config nope":                          ErrorCodeInvalidArguments,
+		"/start":                                ErrorCodeNotInRoom,
+		`{"command": "hit", "payload": {"hit": 4}}`:                                                              ErrorCodeNotInRoom,
+		`{"command": "join", "payload": {"roomName": "zoo", "spawn": {"moles": 1, "specials": {"unicorn": 5}}}}`: ErrorCodeInvalidArguments,
+	}
+	for msg, want := range cases {
+		socketRequest, err := session.parseCommand(msg)
+		if err == nil {
+			t.Errorf("want %q rejected", msg)
+			continue
+		}
+		if got := newErrorMessage(socketRequest.Command, err).Code; got != want {
+			t.Errorf("%q: want code %s, got %s", msg, want, got)
+		}
+	}
+}
+
+func TestRejectedJoinKeepsCurrentRoom(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	alice := &Session{Id: "alice", rooms: rooms, out: make(chan []byte, 64)}
+	if _, err := alice.parseCommand("/join arena"); err != nil {
+		t.Fatalf("want arena created, got %v", err)
+	}
+	arena := alice.room
+	config := DefaultGameConfig()
+	config.Password = "hunter2"
+	rooms.GetOrCreate("den", func() (*Game, error) {
+		return newGame("den", config.normalize(), []string{}, []*Session{}), nil
+	})
+
+	socketRequest, err := alice.parseCommand("/join den wrong")
+	if got := newErrorMessage(socketRequest.Command, err).Code; got != ErrorCodeWrongCredentials {
+		t.Errorf("want code %s, got %s", ErrorCodeWrongCredentials, got)
+	}
+	if alice.room != arena || !arena.HasPlayer("alice") {
+		t.Fatalf("want alice still in arena after a rejected join")
+	}
+
+	arena.mu.Lock()
+	arena.ticker.Stop()
+	arena.setState(Running)
+	arena.mu.Unlock()
+	if _, err := alice.parseCommand("/join park"); err != ErrorGameInProgress {
+		t.Errorf("want %v while arena runs, got %v", ErrorGameInProgress, err)
+	}
+	if _, ok := rooms.Get("park"); ok || !arena.HasPlayer("alice") {
+		t.Errorf("want alice kept in arena without creating park")
+	}
+}
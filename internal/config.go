@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// GameConfig holds every setting of a room. It can be sent along with
+// connect or join, or to the HTTP API, when creating a room. Zero values
+// fall back to the defaults. Scoring and Input are replaced as a whole, a
+// Spawn without moles gets the default mole and rabbit counts
+type GameConfig struct {
+	DurationMs int64 `json:"durationMs"`
+	// How often the engine resolves hits and expires targets
+	TickMs         int64        `json:"tickMs"`
+	StartingHealth int64        `json:"startingHealth"`
+	Rows           int          `json:"rows"`
+	Cols           int          `json:"cols"`
+	Spawn          SpawnPolicy  `json:"spawn"`
+	Scoring        ScoringRules `json:"scoring"`
+	Input          InputRules   `json:"input"`
+	MinPlayers     int          `json:"minPlayers"`
+	MaxPlayers     int          `json:"maxPlayers"`
+	// Whether the room is private. Left out, new rooms are public and a
+	// later config keeps the room as it is
+	Private *bool `json:"private,omitempty"`
+	// Password of a private room, setting it makes the room private. It is
+	// never sent back and is kept when a later config leaves it out
+	Password string       `json:"password,omitempty"`
+	Mode     ModeSettings `json:"mode"`
+}
+
+const (
+	defaultDurationMs     = 60000
+	defaultStartingHealth = 3
+	defaultMinPlayers     = 2
+	defaultMaxPlayers     = 2
+	maxPlayersPerRoom     = 16
+)
+
+// DefaultGameConfig returns the settings of a room created without a config
+func DefaultGameConfig() GameConfig {
+	return GameConfig{
+		DurationMs:     defaultDurationMs,
+		TickMs:         engineTick.Milliseconds(),
+		StartingHealth: defaultStartingHealth,
+		Rows:           defaultBoardRows,
+		Cols:           defaultBoardCols,
+		Spawn:          defaultSpawnPolicy,
+		Scoring:        defaultScoring,
+		Input:          defaultInput,
+		MinPlayers:     defaultMinPlayers,
+		MaxPlayers:     defaultMaxPlayers,
+		Mode:           defaultModeSettings,
+	}
+}
+
+// normalize fills in the settings left out by the client
+func (c GameConfig) normalize() GameConfig {
+	defaults := DefaultGameConfig()
+	if c.DurationMs == 0 {
+		c.DurationMs = defaults.DurationMs
+	}
+	if c.TickMs == 0 {
+		c.TickMs = defaults.TickMs
+	}
+	if c.StartingHealth == 0 {
+		c.StartingHealth = defaults.StartingHealth
+	}
+	if c.Rows == 0 && c.Cols == 0 {
+		c.Rows, c.Cols = defaults.Rows, defaults.Cols
+	}
+	if c.Spawn.Moles == 0 {
+		c.Spawn.Moles = defaults.Spawn.Moles
+		if c.Spawn.Rabbits == 0 {
+			c.Spawn.Rabbits = defaults.Spawn.Rabbits
+		}
+	}
+	c.Spawn = c.Spawn.normalize()
+	if c.Scoring == (ScoringRules{}) {
+		c.Scoring = defaults.Scoring
+	}
+	if c.Input == (InputRules{}) {
+		c.Input = defaults.Input
+	}
+	if c.MinPlayers == 0 {
+		c.MinPlayers = defaults.MinPlayers
+	}
+	if c.MaxPlayers == 0 {
+		c.MaxPlayers = c.MinPlayers
+	}
+	if c.Mode.Name == "" {
+		c.Mode.Name = defaults.Mode.Name
+	}
+	if c.Password != "" && c.Private == nil {
+		private := true
+		c.Private = &private
+	}
+	return c
+}
+
+// validate checks a normalized config
+func (c GameConfig) validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrorInvalidArguments, fmt.Sprintf(format, args...))
+	}
+	if c.DurationMs < 5000 || c.DurationMs > 30*60000 {
+		return invalid("duration must be between 5 seconds and 30 minutes")
+	}
+	if c.TickMs < 10 || c.TickMs > 1000 {
+		return invalid("tick must be between 10 and 1000 ms")
+	}
+	if c.StartingHealth < 1 || c.StartingHealth > 20 {
+		return invalid("starting health must be between 1 and 20")
+	}
+	if err := validateBoardSize(c.Rows, c.Cols); err != nil {
+		return err
+	}
+	if err := c.Spawn.validate(c.Rows * c.Cols); err != nil {
+		return err
+	}
+	if c.TickMs*2 > c.Spawn.MinLifetimeMs {
+		return invalid("targets must stay for at least two ticks")
+	}
+	if c.Scoring.StreakStep < 0 || c.Scoring.MaxMultiplier < 1 || c.Scoring.ReactionBonus < 0 || c.Scoring.ReactionWindowMs < 0 || c.Scoring.MissPenalty < 0 {
+		return invalid("scoring rules cannot be negative and the multiplier starts at 1")
+	}
+	if c.Input.MaxActionsPerRound < 1 || c.Input.MaxActionsPerSecond < 1 {
+		return invalid("input limits must allow at least one hit")
+	}
+	if c.MinPlayers < 2 || c.MaxPlayers < c.MinPlayers || c.MaxPlayers > maxPlayersPerRoom {
+		return invalid("rooms need between 2 and %d players, with max players no lower than min players", maxPlayersPerRoom)
+	}
+	if c.Password != "" && !*c.Private {
+		return invalid("a password needs a private room")
+	}
+	_, err := newGameMode(c.Mode)
+	return err
+}
+
+// newGame builds a room from a valid config without starting its ticker
+func newGame(name string, config GameConfig, players []string, sessions []*Session) *Game {
+	seed := time.Now().UnixNano()
+	game := &Game{
+		seed:        seed,
+		rng:         rand.New(rand.NewSource(seed)),
+		Id:          name,
+		players:     players,
+		state:       WaitEnoughPlayers,
+		playerReady: []string{},
+		actions:     []Action{},
+		sessions:    sessions,
+	}
+	if len(players) > 0 {
+		game.host = players[0]
+	}
+	if len(sessions) == 0 {
+		game.emptySince = time.Now()
+	}
+	game.applyConfig(config)
+	return game
+}
+
+// applyConfig switches the room over to a valid config
+func (g *Game) applyConfig(config GameConfig) {
+	spawner, _ := newSpawner(config.Spawn)
+	mode, _ := newGameMode(config.Mode)
+	if g.ticker != nil && config.TickMs != g.tickMs {
+		g.ticker.Reset(time.Duration(config.TickMs) * time.Millisecond)
+	}
+	g.gameDurationMs = config.DurationMs
+	g.tickMs = config.TickMs
+	g.startingHealth = config.StartingHealth
+	g.maxPlayers = config.MaxPlayers
+	g.minPlayers = config.MinPlayers
+	g.setAccess(config.Private, config.Password)
+	g.rows, g.cols, g.keys = config.Rows, config.Cols, keyLayout(config.Rows, config.Cols)
+	g.spawn = config.Spawn
+	g.spawner = spawner
+	g.scoring = config.Scoring
+	g.input = config.Input
+	g.modeSettings = config.Mode
+	g.mode = mode
+}
+
+// CreateGameWithConfig creates a room with the given sessions in it and
+// starts its engine at the configured tick rate
+func CreateGameWithConfig(name string, config GameConfig, sessions []*Session) (*Game, error) {
+	config = config.normalize()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	players := []string{}
+	for _, s := range sessions {
+		players = append(players, s.Id)
+	}
+	if len(players) > config.MaxPlayers {
+		return nil, ErrorMaxPlayersReached
+	}
+	game := newGame(name, config, players, sessions)
+	game.broadcastLobby()
+	log.Printf("Room %s created with %+v", name, game.config())
+	game.ticker = time.NewTicker(time.Duration(config.TickMs) * time.Millisecond)
+	go game.run(game.ticker)
+	return game, nil
+}
+
+// Config returns the settings of the room
+func (g *Game) Config() GameConfig {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.config()
+}
+
+func (g *Game) config() GameConfig {
+	private := g.private
+	return GameConfig{
+		DurationMs:     g.gameDurationMs,
+		TickMs:         g.tickMs,
+		StartingHealth: g.startingHealth,
+		Rows:           g.rows,
+		Cols:           g.cols,
+		Spawn:          g.spawn,
+		Scoring:        g.scoring,
+		Input:          g.input,
+		MinPlayers:     g.minPlayers,
+		MaxPlayers:     g.maxPlayers,
+		Private:        &private,
+		Mode:           g.modeSettings,
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGameConfigNormalize(t *testing.T) {
+	t.Parallel()
+	config := GameConfig{MinPlayers: 4, Rows: 4, Cols: 5}.normalize()
+	if config.MaxPlayers != 4 || config.DurationMs != defaultDurationMs || config.StartingHealth != defaultStartingHealth {
+		t.Errorf("want defaults filled in around the given settings, got %+v", config)
+	}
+	if err := config.validate(); err != nil {
+		t.Errorf("want config accepted, got %v", err)
+	}
+}
+
+func TestGameConfigNormalizeKeepsSpawnPolicy(t *testing.T) {
+	t.Parallel()
+	config := GameConfig{Spawn: SpawnPolicy{Strategy: SpawnWaves, MaxMoles: 3}}.normalize()
+	spawn := config.Spawn
+	if spawn.Strategy != SpawnWaves || spawn.MaxMoles != 3 || spawn.Moles != defaultSpawnPolicy.Moles || spawn.Rabbits != defaultSpawnPolicy.Rabbits {
+		t.Errorf("want counts filled in around the given policy, got %+v", spawn)
+	}
+	if err := config.validate(); err != nil {
+		t.Errorf("want config accepted, got %v", err)
+	}
+}
+
+func TestGameConfigValidate(t *testing.T) {
+	t.Parallel()
+	cases := map[string]GameConfig{
+		"too short":       {DurationMs: 1000},
+		"slow tick":       {TickMs: 5000},
+		"no health":       {StartingHealth: -1},
+		"too many moles":  {Rows: 2, Cols: 2, Spawn: SpawnPolicy{Moles: 5}},
+		"solo":            {MinPlayers: 1},
+		"max below min":   {MinPlayers: 4, MaxPlayers: 3},
+		"crowded":         {MaxPlayers: maxPlayersPerRoom + 1},
+		"no multiplier":   {Scoring: ScoringRules{StreakStep: 1}},
+		"negative inputs": {Input: InputRules{MaxActionsPerRound: -1, MaxActionsPerSecond: 1}},
+		"unknown mode":    {Mode: ModeSettings{Name: "zen"}},
+		"race to nothing": {Mode: ModeSettings{Name: ModeRace}},
+		"public password": {Password: "hunter2", Private: new(bool)},
+	}
+	for name, config := range cases {
+		if err := config.normalize().validate(); !errors.Is(err, ErrorInvalidArguments) {
+			t.Errorf("%s: want %v, got %v", name, ErrorInvalidArguments, err)
+		}
+	}
+}
+
+func TestCreateGameWithConfig(t *testing.T) {
+	t.Parallel()
+	private := true
+	config := GameConfig{DurationMs: 90000, StartingHealth: 5, MinPlayers: 3, Private: &private}
+	game, err := CreateGameWithConfig("custom", config, []*Session{{Id: "alice"}})
+	if err != nil {
+		t.Fatalf("want room created, got %v", err)
+	}
+	summary := game.Summary()
+	if !summary.IsPrivate || summary.Config.DurationMs != 90000 || summary.Config.MaxPlayers != 3 {
+		t.Errorf("want config in the room summary, got %+v", summary)
+	}
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	game.sessions = append(game.sessions, &Session{Id: "bob"})
+	if board := game.initGameBoard(); board.Healths["alice"] != 5 || board.GameTime != 90000 {
+		t.Errorf("want starting health and duration from the config, got %+v", board)
+	}
+}
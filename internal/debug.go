@@ -0,0 +1,62 @@
+//go:build debug
+// +build debug
+
+package internal
+
+import "time"
+
+// The init and send commands let the web client start a game on its own
+// during development, and seeds replay previous matches. They skip the
+// lobby or give away the board, so they only exist in builds with the debug
+// tag
+func init() {
+	acceptSeeds = true
+	RegisterCommand("init", commandHandler{execute: executeInit})
+	RegisterCommand("send", commandHandler{parse: parseHit, validate: validateHit, execute: executeSend})
+}
+
+// debugStart fills the room with dummy players and starts the game right
+// away
+func debugStart(s *Session) error {
+	room, err := s.currentRoom()
+	if err != nil {
+		return err
+	}
+	room.debugStart(s)
+	return nil
+}
+
+func executeInit(s *Session, payload SocketPayload) error {
+	return debugStart(s)
+}
+
+func executeSend(s *Session, payload SocketPayload) error {
+	if err := debugStart(s); err != nil {
+		return err
+	}
+	key, err := hitKey(s.room, payload)
+	if err != nil {
+		return err
+	}
+	return s.room.AddAction(s.receivedAt.UnixNano(), "Bob", key)
+}
+
+// debugStart fills the room with two dummy players, all sharing the caller's
+// session, and starts the game right away. Only rooms still in the lobby are
+// started
+func (g *Game) debugStart(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return
+	}
+	for _, playerId := range []string{"Bob", "Alice"} {
+		if len(g.players) < g.maxPlayers {
+			g.players = append(g.players, playerId)
+			g.sessions = append(g.sessions, s)
+		}
+	}
+	g.setState(Running)
+	g.board = g.initGameBoard()
+	g.startTime = time.Now()
+}
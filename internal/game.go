@@ -1,122 +1,312 @@
 package internal
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"log"
 	"math/rand"
 	"sort"
+	"sync"
 	"time"
 )
 
 type GameBoard struct {
-	Scores     map[string]int64 `json:"score"`
-	Healths    map[string]int64 `json:"health"`
-	GameTime   int64            `json:"timeLeft"`
-	Board      [3][3]int        `json:"boardInt"`
-	BoardState [9]string        `json:"board"`
-	State      string           `json:"state"`
+	Scores  map[string]int64 `json:"score"`
+	Healths map[string]int64 `json:"health"`
+	// Milliseconds left as given by the game mode, -1 without a timer
+	GameTime   int64    `json:"timeLeft"`
+	Board      [][]int  `json:"boardInt"`
+	BoardState []string `json:"board"`
+	State      string   `json:"state"`
+	// Key bound to each cell, row by row
+	Keys []string `json:"keys"`
+	// Incremented every time a target appears or leaves the board
+	Round int `json:"round"`
+	// Streak of each player
+	Stats map[string]*ComboStats `json:"stats"`
 }
 
 type GameState struct {
 	slug string
 }
 
-var ErrorMaxPlayersReached = errors.New("max players reached")
-var keyMap = map[string][]int{"w": []int{0, 0}, "e": []int{0, 1}, "r": []int{0, 2}, "s": []int{1, 0}, "d": []int{1, 1}, "f": []int{1, 2}, "x": []int{2, 0}, "c": []int{2, 1}, "v": []int{2, 2}}
+// Cell values used in GameBoard.Board, see TargetType for the rest
+const (
+	EmptyCell = iota
+	MoleCell
+	RabbitCell
+	SuperMoleCell
+)
 
-func generateGameBoard(prevBoard [3][3]int) ([3][3]int, int, int) {
-	molePosX := rand.Intn(3)
-	molePosY := rand.Intn(3)
-	rabbitPosX := rand.Intn(3)
-	rabbitPosY := rand.Intn(3)
-	for rabbitPosX == molePosX && rabbitPosY == molePosY {
-		rabbitPosX = rand.Intn(3)
-		rabbitPosY = rand.Intn(3)
-	}
-	newBoard := [3][3]int{}
-	newBoard[molePosX][molePosY] = 1
-	newBoard[rabbitPosX][rabbitPosY] = 2
-	return newBoard, molePosX*3 + molePosY, rabbitPosX*3 + rabbitPosY
-}
+var (
+	ErrorMaxPlayersReached = errors.New("max players reached")
+	ErrorMalformedRequest  = errors.New("malformed request")
+	ErrorUnknownCommand    = errors.New("unknown command")
+	ErrorInvalidArguments  = errors.New("invalid arguments")
+	ErrorNotInRoom         = errors.New("not in a room")
+	ErrorGameNotRunning    = errors.New("game is not running")
+	ErrorGameInProgress    = errors.New("game is in progress")
+	ErrorFrozen            = errors.New("input is frozen")
+	ErrorRateLimited       = errors.New("too many hits")
+	ErrorImpossibleInput   = errors.New("impossible input rate")
+	ErrorNotHost           = errors.New("only the host can do that")
+	ErrorRoomLocked        = errors.New("room is locked")
+	ErrorRoomClosed        = errors.New("room is closed")
+	ErrorNotEnoughReady    = errors.New("not enough players are ready")
+	ErrorWrongCredentials  = errors.New("wrong password or invite code")
+)
 
 func (g *Game) initGameBoard() GameBoard {
 	var scores = make(map[string]int64)
 	var healths = make(map[string]int64)
+	var stats = make(map[string]*ComboStats)
 	for _, s := range g.sessions {
 		scores[s.Id] = 0
-		healths[s.Id] = 3
+		healths[s.Id] = g.startingHealth
+		stats[s.Id] = &ComboStats{Multiplier: 1}
 	}
-	newGameBoard := [3][3]int{}
-	return GameBoard{Scores: scores, Healths: healths, GameTime: g.gameDurationMs, Board: newGameBoard, State: "running", BoardState: [9]string{"", "", "", "", "", "", "", "", ""}}
+	newGameBoard, boardState := emptyBoard(g.rows, g.cols)
+	g.targets = []*target{}
+	g.frozenUntil = map[string]int64{}
+	return GameBoard{Scores: scores, Healths: healths, GameTime: g.gameDurationMs, Board: newGameBoard, State: "running", BoardState: boardState, Keys: g.keys, Stats: stats}
 }
 
 func (g *Game) transitionGameState() {
 	timeElapsed := time.Since(g.startTime).Milliseconds()
-	timeLeft := g.gameDurationMs - timeElapsed
-	if g.state == Running && timeLeft <= 0 {
-		g.state = Over
-		for _, s := range g.sessions {
-			msgToClient := fmt.Sprintf("[%s]: Game is over\n", s.Id)
-			s.out <- []byte(msgToClient)
-		}
-		keys := make([]string, 0, len(g.board.Scores))
-
-		for key := range g.board.Scores {
-			keys = append(keys, key)
-		}
-
-		sort.SliceStable(keys, func(i, j int) bool {
-			return g.board.Scores[keys[i]] < g.board.Scores[keys[j]]
-		})
-		log.Println("Game is over")
+	if g.state == Tiebreak {
+		g.resolveTiebreak()
 	}
 	if g.state == Running {
-		encodedBoard, _ := json.Marshal(g.board)
-		actions := g.actions
-		sort.SliceStable(actions, func(i, j int) bool {
-			return actions[i].timestamp < actions[j].timestamp
-		})
-		for _, item := range g.actions {
-			key, exists := keyMap[item.msg]
-			if exists {
-				if g.board.Board[key[0]][key[1]] == 1 {
-					g.board.Scores[item.id] += 1
-				}
-				if g.board.Board[key[0]][key[1]] == 2 {
-					g.board.Healths[item.id] -= 1
-				}
+		now := time.Now()
+		g.resolveHits()
+		g.despawnExpired(now)
+		for id, health := range g.board.Healths {
+			if health <= 0 && !contains(g.eliminated, id) {
+				g.eliminate(id)
 			}
 		}
-		for _, s := range g.sessions {
-			s.out <- encodedBoard
+		if reason, over := g.mode.Check(g, timeElapsed); over {
+			g.finish(reason)
+			return
 		}
-		boardState := [9]string{"", "", "", "", "", "", "", "", ""}
-		newGameBoard, moleIdx, rabbitIdx := generateGameBoard(g.board.Board)
-		boardState[moleIdx] = "m"
-		boardState[rabbitIdx] = "r"
-		newBoard := GameBoard{Scores: g.board.Scores, Healths: g.board.Healths, GameTime: timeLeft, Board: newGameBoard, State: "running", BoardState: boardState}
-		g.board = newBoard
-		log.Printf("Game will be over in : %d seconds\nScores: %v", timeLeft, g.board.Scores)
+		// Untimed modes ramp up over the game duration all the same
+		g.spawnTargets(float64(timeElapsed) / float64(g.gameDurationMs))
+		g.board.GameTime = g.mode.TimeLeftMs(g, timeElapsed)
+		g.publishBoard(now)
 	}
-	if len(g.Players) == g.minPlayers && g.state == WaitEnoughPlayers {
-		g.state = WaitPlayersReady
+	if len(g.players) >= g.minPlayers && g.state == WaitEnoughPlayers {
+		g.setState(WaitPlayersReady)
 		log.Printf("Waiting for players to get ready: %d/%d\n", len(g.playerReady), g.minPlayers)
 	}
-	if len(g.playerReady) == g.minPlayers && g.state == WaitPlayersReady {
-		for _, s := range g.sessions {
-			s.out <- []byte("Game started")
-		}
+	countdownOver := !g.countdownEnds.IsZero() && !time.Now().Before(g.countdownEnds)
+	if (len(g.playerReady) == len(g.players) || countdownOver) && g.state == WaitPlayersReady {
+		g.countdownEnds = time.Time{}
+		g.broadcast(MessageGameStarted, GameStartedMessage{Room: g.Id})
 		newBoard := g.initGameBoard()
-		g.state = Running
+		g.setState(Running)
 		log.Println("Game is starting")
 		g.board = newBoard
 		g.startTime = time.Now()
 	}
 }
 
+// resolveHits applies the queued hits, oldest first. A player hits each
+// target once and the first player to hit a claimable target takes it off
+// the board. Hits on empty cells break the streak of the player
+func (g *Game) resolveHits() {
+	for _, item := range g.queuedActions() {
+		t := item.target
+		if contains(g.eliminated, item.id) || g.isFrozen(item.id, item.timestamp) {
+			continue
+		}
+		if t == nil {
+			g.miss(item.id, item.msg)
+			continue
+		}
+		if t.hitBy[item.id] {
+			continue
+		}
+		t.hitBy[item.id] = true
+		targetType := targetTypes[t.kind]
+		if targetType.Claimable {
+			if t.claimedBy != "" {
+				g.sendTo(item.id, MessageTooLate, TooLateMessage{Key: item.msg, ClaimedBy: t.claimedBy})
+				continue
+			}
+			t.claimedBy = item.id
+			g.despawnTarget(t, DespawnHit)
+		}
+		if targetType.Score > 0 {
+			g.board.Scores[item.id] += g.mode.Score(targetType.Score, g.scoreHit(item.id, t, item.timestamp))
+			g.statsFor(item.id).hits += 1
+		} else {
+			g.board.Scores[item.id] += targetType.Score
+		}
+		if targetType.Health < 0 {
+			g.breakStreak(item.id)
+			g.statsFor(item.id).rabbitHits += 1
+		}
+		g.board.Healths[item.id] += targetType.Health
+		if g.board.Healths[item.id] > g.startingHealth {
+			g.board.Healths[item.id] = g.startingHealth
+		}
+		if targetType.FreezeMs > 0 {
+			g.freezeOpponents(item.id, item.timestamp, targetType.FreezeMs)
+		}
+	}
+}
+
+// miss breaks the streak of a player who hit an empty cell and takes the
+// miss penalty off their score, which never goes below zero
+func (g *Game) miss(playerId string, key string) {
+	g.breakStreak(playerId)
+	g.statsFor(playerId).misses += 1
+	penalty := g.scoring.MissPenalty
+	if penalty > g.board.Scores[playerId] {
+		penalty = g.board.Scores[playerId]
+	}
+	g.board.Scores[playerId] -= penalty
+	g.sendTo(playerId, MessageMiss, MissMessage{Key: key, Penalty: penalty})
+}
+
+// freezeOpponents stops every player but playerId from hitting anything for
+// durationMs after ts
+func (g *Game) freezeOpponents(playerId string, ts int64, durationMs int64) {
+	if g.frozenUntil == nil {
+		g.frozenUntil = map[string]int64{}
+	}
+	for id := range g.board.Scores {
+		if id != playerId && !contains(g.eliminated, id) {
+			g.frozenUntil[id] = ts + durationMs*int64(time.Millisecond)
+			g.sendTo(id, MessageFrozen, FrozenMessage{By: playerId, DurationMs: durationMs})
+		}
+	}
+}
+
+// isFrozen tells whether a hit by playerId at ts falls within a freeze
+func (g *Game) isFrozen(playerId string, ts int64) bool {
+	return ts < g.frozenUntil[playerId]
+}
+
+// alivePlayers returns the players on the board that have not been eliminated
+func (g *Game) alivePlayers() []string {
+	alive := []string{}
+	for id := range g.board.Scores {
+		if !contains(g.eliminated, id) {
+			alive = append(alive, id)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+// eliminate marks a player out of the game. Their actions are ignored from now on
+func (g *Game) eliminate(playerId string) {
+	g.eliminated = append(g.eliminated, playerId)
+	g.statsFor(playerId).eliminatedAtMs = time.Since(g.startTime).Milliseconds()
+	g.sendTo(playerId, MessageEliminated, EliminatedMessage{Player: playerId})
+	log.Printf("Player %s has been eliminated", playerId)
+}
+
+// finish ends the game with the leading player as winner, or starts a tiebreak
+// if the leaders cannot be separated. Eliminated players are only considered
+// when nobody is left standing
+func (g *Game) finish(reason EndReason) {
+	candidates := g.alivePlayers()
+	if len(candidates) == 0 {
+		for id := range g.board.Scores {
+			candidates = append(candidates, id)
+		}
+	}
+	leaders := g.leaders(candidates)
+	if len(leaders) > 1 {
+		g.startTiebreak(leaders)
+		return
+	}
+	var winner string
+	if len(leaders) == 1 {
+		winner = leaders[0]
+	}
+	g.endGame(winner, reason)
+}
+
+// leaders returns the candidates with the highest score, using remaining
+// health to separate players on the same score
+func (g *Game) leaders(candidates []string) []string {
+	leaders := []string{}
+	for _, id := range candidates {
+		score := g.board.Scores[id]
+		if len(leaders) == 0 {
+			leaders = append(leaders, id)
+			continue
+		}
+		bestScore := g.board.Scores[leaders[0]]
+		bestHealth := g.board.Healths[leaders[0]]
+		health := g.board.Healths[id]
+		switch {
+		case score > bestScore || (score == bestScore && health > bestHealth):
+			leaders = []string{id}
+		case score == bestScore && health == bestHealth:
+			leaders = append(leaders, id)
+		}
+	}
+	sort.Strings(leaders)
+	return leaders
+}
+
+// startTiebreak clears the board and spawns a single super mole that stays
+// until hit. Only the tied players can hit it and whoever hits it first wins
+// the game
+func (g *Game) startTiebreak(players []string) {
+	g.setState(Tiebreak)
+	g.tiebreakPlayers = players
+	g.actions = []Action{}
+	g.clearTargets(DespawnCleared)
+	g.board.GameTime = 0
+	g.board.State = Tiebreak.String()
+	g.broadcast(MessageTiebreak, TiebreakMessage{Players: players})
+	g.spawnTarget(g.rng.Intn(g.rows*g.cols), SuperMoleCell, 0)
+	g.publishBoard(time.Now())
+	log.Printf("Tiebreak between %v", players)
+}
+
+func (g *Game) resolveTiebreak() {
+	for _, item := range g.queuedActions() {
+		if !contains(g.tiebreakPlayers, item.id) {
+			continue
+		}
+		if item.target != nil && item.target.kind == SuperMoleCell {
+			item.target.claimedBy = item.id
+			g.statsFor(item.id).hits += 1
+			g.despawnTarget(item.target, DespawnHit)
+			g.endGame(item.id, EndReasonTiebreak)
+			return
+		}
+	}
+	g.publishBoard(time.Now())
+}
+
+// queuedActions empties the action queue and returns its actions, oldest
+// first
+func (g *Game) queuedActions() []Action {
+	actions := g.actions
+	g.actions = []Action{}
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].timestamp < actions[j].timestamp
+	})
+	return actions
+}
+
+func (g *Game) endGame(winner string, reason EndReason) {
+	g.winner = winner
+	g.setState(Over)
+	g.board.State = Over.String()
+	g.result = g.buildResult(reason)
+	g.broadcast(MessageResult, g.result)
+	log.Printf("Game is over (%s). Winner: %s", reason, winner)
+}
+
 func (g GameState) String() string {
 	return g.slug
 }
@@ -125,6 +315,7 @@ var (
 	Running           = GameState{"running"}
 	WaitEnoughPlayers = GameState{"waitEnoughPlayers"}
 	WaitPlayersReady  = GameState{"waitPlayersReady"}
+	Tiebreak          = GameState{"tiebreak"}
 	Over              = GameState{"over"}
 )
 
@@ -132,22 +323,79 @@ type Action struct {
 	timestamp int64
 	id        string
 	msg       string
+	// Target in the cell when the action was received, nil for a miss
+	target *target
 }
 
 type Game struct {
+	// Guards every field below. Exported methods take the lock, unexported
+	// ones expect the caller to hold it
+	mu sync.Mutex
 	// Id must be unique. Akin to room name
 	actions        []Action
 	Id             string
 	startTime      time.Time
 	gameDurationMs int64
+	tickMs         int64
+	startingHealth int64
 	maxPlayers     int
 	minPlayers     int
-	Players        []string
-	state          GameState
-	playerReady    []string
-	conn           map[string]*websocket.Conn
-	sessions       []*Session
-	board          GameBoard
+	// Private rooms are hidden from room listings and only let in players
+	// who know the password or the invite code
+	private    bool
+	password   string
+	inviteCode string
+	// Player who runs the room, the first player in it until they leave
+	host string
+	// Locked rooms do not let new players in
+	locked bool
+	// When the countdown started by the host ends, zero without countdown
+	countdownEnds time.Time
+	// Closed rooms are out of the registry and their engine is stopped
+	closed bool
+	// When the game ended and when the last session left, see RoomLifecycle
+	overAt      time.Time
+	emptySince  time.Time
+	ticker      *time.Ticker
+	players     []string
+	state       GameState
+	playerReady []string
+	conn        map[string]*websocket.Conn
+	sessions    []*Session
+	board       GameBoard
+	rows        int
+	cols        int
+	// Key bound to each cell, row by row
+	keys    []string
+	spawn   SpawnPolicy
+	spawner Spawner
+	scoring ScoringRules
+	input   InputRules
+	// How the game is won, built from modeSettings
+	modeSettings ModeSettings
+	mode         GameMode
+	// Receipt time of the hits each player sent in the last second
+	recentInputs map[string][]int64
+	// Targets on the board, each with its own lifetime
+	targets      []*target
+	lastTargetId int
+	// Players hit by a freeze cannot hit anything before this time, in
+	// nanoseconds
+	frozenUntil map[string]int64
+	// Whether targets changed since the board was last pushed to clients
+	boardChanged bool
+	lastPublish  time.Time
+	// Every random choice in the game comes from rng, seeded with seed, so a
+	// match can be replayed exactly
+	seed int64
+	rng  *rand.Rand
+	// Players whose health reached zero, their actions are ignored
+	eliminated []string
+	// Players tied at the end of the game, only they can hit the super mole
+	tiebreakPlayers []string
+	winner          string
+	stats           map[string]*playerStats
+	result          *GameResult
 }
 
 func CreateGame(name string, minPlayers int, maxPlayers int, players []string, ticker *time.Ticker, conns map[string]*websocket.Conn) (*Game, error) {
@@ -160,20 +408,12 @@ func CreateGame(name string, minPlayers int, maxPlayers int, players []string, t
 	if len(players) > maxPlayers {
 		return nil, ErrorMaxPlayersReached
 	}
-	newGame := &Game{gameDurationMs: 60000, Id: name, maxPlayers: maxPlayers, minPlayers: minPlayers, Players: players, state: WaitEnoughPlayers, playerReady: []string{}, conn: conns, actions: []Action{}}
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				newGame.transitionGameState()
-			}
-			if newGame.state == Over {
-				ticker.Stop()
-				log.Println("Ticker is stopped. Game over")
-				return
-			}
-		}
-	}()
+	config := DefaultGameConfig()
+	config.MinPlayers, config.MaxPlayers = minPlayers, maxPlayers
+	newGame := newGame(name, config, players, nil)
+	newGame.conn = conns
+	newGame.ticker = ticker
+	go newGame.run(ticker)
 	return newGame, nil
 }
 
@@ -187,39 +427,252 @@ func CreateGameV2(name string, minPlayers int, maxPlayers int, players []string,
 	if len(players) > maxPlayers {
 		return nil, ErrorMaxPlayersReached
 	}
-	newGame := &Game{gameDurationMs: 60000, Id: name, maxPlayers: maxPlayers, minPlayers: minPlayers, Players: players, state: WaitEnoughPlayers, playerReady: []string{}, actions: []Action{}, sessions: sessions}
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				newGame.transitionGameState()
-			}
-			if newGame.state == Over {
-				ticker.Stop()
-				log.Println("Ticker is stopped. Game over")
-				return
-			}
-		}
-	}()
+	config := DefaultGameConfig()
+	config.MinPlayers, config.MaxPlayers = minPlayers, maxPlayers
+	newGame := newGame(name, config, players, sessions)
+	newGame.ticker = ticker
+	go newGame.run(ticker)
 	return newGame, nil
 }
 
-func (g *Game) AddPlayer(playerId string, session *Session) error {
-	if len(g.Players) == g.maxPlayers {
+// run advances the game on every tick until it is over
+func (g *Game) run(ticker *time.Ticker) {
+	for range ticker.C {
+		if over := g.tick(); over {
+			ticker.Stop()
+			log.Println("Ticker is stopped. Game over")
+			return
+		}
+	}
+}
+
+func (g *Game) tick() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.transitionGameState()
+	return g.state == Over || g.closed
+}
+
+// State returns the current state of the game
+func (g *Game) State() GameState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// SetSeed reseeds the random number generator of the game so a previous match
+// can be replayed, only allowed before the game starts
+func (g *Game) SetSeed(seed int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return ErrorGameInProgress
+	}
+	g.seed = seed
+	g.rng = rand.New(rand.NewSource(seed))
+	return nil
+}
+
+// Players returns a copy of the players in the room
+func (g *Game) Players() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string{}, g.players...)
+}
+
+// AddPlayer lets the player into the room while it is still in the lobby.
+// credential is the password or invite code of a private room, ignored for
+// public rooms
+func (g *Game) AddPlayer(playerId string, session *Session, credential string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrorRoomClosed
+	}
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return ErrorGameInProgress
+	}
+	if !g.admits(credential) {
+		return ErrorWrongCredentials
+	}
+	if g.locked {
+		return ErrorRoomLocked
+	}
+	if len(g.players) == g.maxPlayers {
 		return ErrorMaxPlayersReached
 	}
-	g.Players = append(g.Players, playerId)
+	g.players = append(g.players, playerId)
 	g.sessions = append(g.sessions, session)
+	g.emptySince = time.Time{}
+	if g.host == "" {
+		g.host = playerId
+	}
 	log.Printf("%d no of connections registered", len(g.sessions))
+	g.broadcastLobby()
+	return nil
+}
+
+// RemovePlayer takes the player out of the room along with their session
+func (g *Game) RemovePlayer(playerId string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.removePlayer(playerId)
+}
+
+// Kick removes playerId from the room on behalf of the host, only allowed
+// in the lobby so the host cannot knock the leader out of a game
+func (g *Game) Kick(hostId string, playerId string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hostId != g.host {
+		return ErrorNotHost
+	}
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return ErrorGameInProgress
+	}
+	if playerId == hostId || !contains(g.players, playerId) {
+		return fmt.Errorf("%w: %s cannot be kicked", ErrorInvalidArguments, playerId)
+	}
+	g.sendTo(playerId, MessageKicked, KickedMessage{Room: g.Id, By: hostId})
+	g.removePlayer(playerId)
 	return nil
 }
 
+// removePlayer forfeits the game of a player leaving while it runs. A room
+// waiting for players to get ready goes back to waiting for players if it
+// drops below minPlayers
+func (g *Game) removePlayer(playerId string) {
+	if g.state == Running || g.state == Tiebreak {
+		g.forfeit(playerId)
+	}
+	g.players = remove(g.players, playerId)
+	g.playerReady = remove(g.playerReady, playerId)
+	sessions := []*Session{}
+	for _, s := range g.sessions {
+		if s.Id != playerId {
+			sessions = append(sessions, s)
+		}
+	}
+	g.sessions = sessions
+	if len(g.sessions) == 0 {
+		g.emptySince = time.Now()
+	}
+	if playerId == g.host {
+		g.transferHost()
+	}
+	g.checkCountdown()
+	if g.state == WaitPlayersReady && len(g.players) < g.minPlayers {
+		g.setState(WaitEnoughPlayers)
+		return
+	}
+	g.broadcastLobby()
+}
+
+// forfeit eliminates a player who left a running game. A tiebreak left with
+// a single player is won by that player
+func (g *Game) forfeit(playerId string) {
+	if _, playing := g.board.Scores[playerId]; playing && !contains(g.eliminated, playerId) {
+		g.eliminate(playerId)
+	}
+	if g.state == Tiebreak && contains(g.tiebreakPlayers, playerId) {
+		g.tiebreakPlayers = remove(g.tiebreakPlayers, playerId)
+		if len(g.tiebreakPlayers) == 1 {
+			g.endGame(g.tiebreakPlayers[0], EndReasonLastStanding)
+		}
+	}
+}
+
+// HasPlayer tells whether playerId is in the room
+func (g *Game) HasPlayer(playerId string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return contains(g.players, playerId)
+}
+
+// Summary describes the room as shown in the lobby
+func (g *Game) Summary() GameRoomStream {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.roomStream()
+}
+
+func (g *Game) roomStream() GameRoomStream {
+	waitingPlayers := []string{}
+	for _, p := range g.players {
+		if !contains(g.playerReady, p) {
+			waitingPlayers = append(waitingPlayers, p)
+		}
+	}
+	return GameRoomStream{
+		Name:           g.Id,
+		Host:           g.host,
+		Locked:         g.locked,
+		IsPrivate:      g.private,
+		InviteCode:     g.inviteCode,
+		State:          g.state.String(),
+		ReadyPlayers:   append([]string{}, g.playerReady...),
+		WaitingPlayers: waitingPlayers,
+		Config:         g.config(),
+	}
+}
+
+// broadcastLobby pushes the lobby view of the room to every session in it
+func (g *Game) broadcastLobby() {
+	g.broadcast(MessageRoom, g.roomStream())
+}
+
+// setState moves the game to state and tells every session in the room
+func (g *Game) setState(state GameState) {
+	g.state = state
+	if state == Over {
+		g.overAt = time.Now()
+	}
+	g.broadcastLobby()
+}
+
 func (g *Game) AddPlayerReady(playerId string) {
-	if !contains(g.playerReady, playerId) && contains(g.Players, playerId) && g.state == WaitPlayersReady {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !contains(g.playerReady, playerId) && contains(g.players, playerId) && g.state == WaitPlayersReady {
 		g.playerReady = append(g.playerReady, playerId)
+		g.broadcastLobby()
+	}
+}
+
+// RemovePlayerReady takes back the ready of a player before the game starts
+func (g *Game) RemovePlayerReady(playerId string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if contains(g.playerReady, playerId) && g.state == WaitPlayersReady {
+		g.playerReady = remove(g.playerReady, playerId)
+		g.checkCountdown()
+		g.broadcastLobby()
 	}
 }
 
-func (g *Game) AddAction(ts int64, playerId string, msg string) {
-	g.actions = append(g.actions, Action{timestamp: ts, id: playerId, msg: msg})
+// AddAction queues a hit on the cell bound to key msg, resolved on the next
+// tick. ts is the server receipt time in nanoseconds, it decides which target
+// was hit and who hit a mole first
+func (g *Game) AddAction(ts int64, playerId string, msg string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.state != Running && g.state != Tiebreak {
+		return ErrorGameNotRunning
+	}
+	if _, playing := g.board.Healths[playerId]; !playing {
+		return ErrorNotInRoom
+	}
+	row, col, ok := g.cellOf(msg)
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrorInvalidArguments, msg)
+	}
+	if g.isFrozen(playerId, ts) {
+		return ErrorFrozen
+	}
+	if err := g.checkInput(playerId, ts); err != nil {
+		return err
+	}
+	hit := g.liveTarget(row*g.cols+col, time.Unix(0, ts))
+	g.actions = append(g.actions, Action{timestamp: ts, id: playerId, msg: msg, target: hit})
+	return nil
 }
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestGame returns a running game on an empty 3x3 board, seeded with 1
+func newTestGame(scores map[string]int64, healths map[string]int64) *Game {
+	board, boardState := emptyBoard(defaultBoardRows, defaultBoardCols)
+	return &Game{
+		Id:             "test",
+		state:          Running,
+		startTime:      time.Now(),
+		gameDurationMs: defaultDurationMs,
+		startingHealth: defaultStartingHealth,
+		actions:        []Action{},
+		rows:           defaultBoardRows,
+		cols:           defaultBoardCols,
+		keys:           keyLayout(defaultBoardRows, defaultBoardCols),
+		spawn:          defaultSpawnPolicy,
+		spawner:        UniformSpawner{},
+		scoring:        defaultScoring,
+		input:          defaultInput,
+		modeSettings:   defaultModeSettings,
+		mode:           TimedMode{},
+		seed:           1,
+		rng:            rand.New(rand.NewSource(1)),
+		targets:        []*target{},
+		board:          GameBoard{Scores: scores, Healths: healths, Board: board, BoardState: boardState},
+	}
+}
+
+func TestTiebreakWinner(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(
+		map[string]int64{"alice": 3, "bob": 3, "carol": 1},
+		map[string]int64{"alice": 2, "bob": 2, "carol": 3},
+	)
+	game.startTime = time.Now().Add(-time.Minute)
+	game.transitionGameState()
+	if game.state != Tiebreak {
+		t.Fatalf("want state %s, got %s", Tiebreak, game.state)
+	}
+
+	var superMoleKey string
+	for i, state := range game.board.BoardState {
+		if state == "s" {
+			superMoleKey = game.keys[i]
+		}
+	}
+	now := time.Now().UnixNano()
+	game.AddAction(now+2, "bob", superMoleKey)
+	game.AddAction(now+1, "carol", superMoleKey)
+	game.AddAction(now+3, "alice", superMoleKey)
+	game.transitionGameState()
+	if game.state != Over {
+		t.Fatalf("want state %s, got %s", Over, game.state)
+	}
+	if game.winner != "bob" {
+		t.Errorf("want winner bob, got %s", game.winner)
+	}
+}
+
+func TestLastPlayerStandingWins(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 5, "bob": 0}, map[string]int64{"alice": 1, "bob": 3})
+	game.spawnTarget(0, RabbitCell, time.Minute)
+	game.AddAction(time.Now().UnixNano(), "alice", "w")
+	game.transitionGameState()
+	if !contains(game.eliminated, "alice") {
+		t.Errorf("want alice eliminated, got %v", game.eliminated)
+	}
+	if game.state != Over {
+		t.Fatalf("want state %s, got %s", Over, game.state)
+	}
+	if game.winner != "bob" {
+		t.Errorf("want winner bob, got %s", game.winner)
+	}
+	if game.result.Reason != EndReasonLastStanding {
+		t.Errorf("want reason %s, got %s", EndReasonLastStanding, game.result.Reason)
+	}
+	loser := game.result.Standings[1]
+	if loser.Id != "alice" || loser.Rank != 2 || loser.RabbitHits != 1 {
+		t.Errorf("want alice ranked 2 with 1 rabbit hit, got %+v", loser)
+	}
+}
+
+func TestConcurrentPlayers(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	game, _, _ := rooms.GetOrCreate("arena", func() (*Game, error) {
+		return CreateGameV2("arena", 2, 40, []string{}, time.NewTicker(time.Millisecond), []*Session{})
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session := &Session{Id: fmt.Sprintf("player-%d", i), out: make(chan []byte, 8), rooms: rooms}
+			for _, msg := range []string{"/join arena", "/ready", "/list", "d", "/leave"} {
+				session.parseCommand(msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(game.Players()) != 0 {
+		t.Errorf("want every player gone, got %v", game.Players())
+	}
+}
+
+func TestLobbyBroadcasts(t *testing.T) {
+	t.Parallel()
+	alice := &Session{Id: "alice", out: make(chan []byte, 16)}
+	game := newGame("lobby", DefaultGameConfig(), []string{"alice"}, []*Session{alice})
+	lastLobby := func() GameRoomStream {
+		var lobby GameRoomStream
+		for len(alice.out) > 0 {
+			var envelope Envelope
+			json.Unmarshal(<-alice.out, &envelope)
+			if envelope.Type == MessageRoom {
+				json.Unmarshal(envelope.Payload, &lobby)
+			}
+		}
+		return lobby
+	}
+	game.AddPlayer("bob", &Session{Id: "bob", out: make(chan []byte, 16)}, "")
+	if lobby := lastLobby(); !reflect.DeepEqual(lobby.WaitingPlayers, []string{"alice", "bob"}) {
+		t.Errorf("want alice and bob waiting, got %+v", lobby)
+	}
+	game.tick()
+	if lobby := lastLobby(); lobby.State != WaitPlayersReady.String() {
+		t.Errorf("want state change pushed, got %+v", lobby)
+	}
+	game.AddPlayerReady("bob")
+	if lobby := lastLobby(); !reflect.DeepEqual(lobby.ReadyPlayers, []string{"bob"}) {
+		t.Errorf("want bob ready, got %+v", lobby)
+	}
+	game.RemovePlayer("bob")
+	if lobby := lastLobby(); !reflect.DeepEqual(lobby.WaitingPlayers, []string{"alice"}) || len(lobby.ReadyPlayers) != 0 {
+		t.Errorf("want only alice left, got %+v", lobby)
+	}
+}
+
+func TestLeaveUnreadyAndKick(t *testing.T) {
+	t.Parallel()
+	config := DefaultGameConfig()
+	config.MaxPlayers = 3
+	bob := &Session{Id: "bob", out: make(chan []byte, 16)}
+	game := newGame("lobby", config, []string{"alice"}, []*Session{{Id: "alice", out: make(chan []byte, 16)}})
+	game.AddPlayer("bob", bob, "")
+	game.AddPlayer("carol", &Session{Id: "carol", out: make(chan []byte, 16)}, "")
+	game.tick()
+	game.AddPlayerReady("bob")
+	game.RemovePlayerReady("bob")
+	if contains(game.playerReady, "bob") {
+		t.Errorf("want bob no longer ready, got %v", game.playerReady)
+	}
+	if err := game.Kick("bob", "carol"); err != ErrorNotHost {
+		t.Errorf("want only the host to kick, got %v", err)
+	}
+	if err := game.Kick("alice", "bob"); err != nil {
+		t.Fatalf("want bob kicked, got %v", err)
+	}
+	if game.HasPlayer("bob") || game.State() != WaitPlayersReady {
+		t.Errorf("want bob gone with enough players left, got %v in %s", game.Players(), game.State())
+	}
+	game.RemovePlayer("carol")
+	if game.State() != WaitEnoughPlayers {
+		t.Errorf("want room back to waiting for players, got %s", game.State())
+	}
+}
+
+func TestLeavingForfeits(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 5, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	game.players = []string{"alice", "bob"}
+	game.host = "bob"
+	if err := game.Kick("bob", "alice"); err != ErrorGameInProgress {
+		t.Errorf("want no kicks while the game runs, got %v", err)
+	}
+	if err := game.AddPlayer("zed", &Session{Id: "zed"}, ""); err != ErrorGameInProgress {
+		t.Errorf("want no players joining while the game runs, got %v", err)
+	}
+	if err := game.AddAction(time.Now().UnixNano(), "zed", "q"); err != ErrorNotInRoom {
+		t.Errorf("want hits from players off the board rejected, got %v", err)
+	}
+	game.RemovePlayer("alice")
+	game.transitionGameState()
+	if game.state != Over || game.winner != "bob" {
+		t.Errorf("want bob to win by forfeit, got %s won by %q", game.state, game.winner)
+	}
+}
+
+func TestActionsScoreOncePerTarget(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	game.spawnTarget(4, RabbitCell, time.Minute)
+	now := time.Now().UnixNano()
+	game.AddAction(now, "alice", "d")
+	game.AddAction(now+1, "alice", "d")
+	game.transitionGameState()
+	if game.board.Healths["alice"] != 2 {
+		t.Errorf("want 1 health lost for repeated hits, got %d left", game.board.Healths["alice"])
+	}
+	if len(game.actions) != 0 {
+		t.Errorf("want action queue emptied, got %d actions", len(game.actions))
+	}
+}
+
+func TestTargetsExpire(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	mole := game.spawnTarget(4, MoleCell, time.Millisecond)
+	game.AddAction(mole.expiresAt.UnixNano(), "bob", "d")
+	game.AddAction(mole.spawnedAt.UnixNano()-1, "alice", "d")
+	time.Sleep(2 * time.Millisecond)
+	game.transitionGameState()
+	if game.board.Scores["alice"] != 0 || game.board.Scores["bob"] != 0 {
+		t.Errorf("want hits outside the mole lifetime ignored, got %v", game.board.Scores)
+	}
+	for _, target := range game.targets {
+		if target == mole {
+			t.Errorf("want expired mole off the board")
+		}
+	}
+}
+
+func TestSpecialTargets(t *testing.T) {
+	t.Parallel()
+	bob := &Session{Id: "bob", out: make(chan []byte, 16)}
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0, "carol": 0}, map[string]int64{"alice": 2, "bob": 3, "carol": 3})
+	game.sessions = []*Session{bob}
+	golden := game.spawnTarget(0, GoldenMoleCell, time.Minute)
+	game.spawnTarget(1, HeartCell, time.Minute)
+	game.spawnTarget(2, FreezeCell, time.Minute)
+	game.spawnTarget(3, BombCell, time.Minute)
+	// Late enough to earn no reaction bonus
+	now := golden.spawnedAt.Add(time.Second).UnixNano()
+	game.AddAction(now, "alice", "w")
+	game.AddAction(now+1, "carol", "s")
+	game.AddAction(now+2, "alice", "e")
+	game.AddAction(now+3, "alice", "e")
+	game.AddAction(now+4, "alice", "r")
+	game.AddAction(now+5, "bob", "s")
+	game.transitionGameState()
+	if game.board.Scores["alice"] != 5 || game.board.Healths["alice"] != 3 {
+		t.Errorf("want alice on 5 points and full health, got %d and %d", game.board.Scores["alice"], game.board.Healths["alice"])
+	}
+	if game.board.Healths["bob"] != 3 || game.board.Healths["carol"] != 0 {
+		t.Errorf("want frozen bob spared by the bomb and carol blown up, got %v", game.board.Healths)
+	}
+	if err := game.AddAction(now+6, "bob", "d"); err != ErrorFrozen {
+		t.Errorf("want %v while frozen, got %v", ErrorFrozen, err)
+	}
+}
+
+func TestStreakAndReactionScoring(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	hit := func(cell int, kind int, reaction time.Duration) {
+		target := game.spawnTarget(cell, kind, time.Minute)
+		game.AddAction(target.spawnedAt.Add(reaction).UnixNano(), "alice", game.keys[cell])
+		game.resolveHits()
+	}
+	for i := 0; i < 3; i++ {
+		hit(i, MoleCell, time.Second)
+	}
+	if game.board.Scores["alice"] != 4 || game.board.Stats["alice"].Multiplier != 2 {
+		t.Errorf("want 1+1+2 points at x2 after 3 hits, got %d at x%d", game.board.Scores["alice"], game.board.Stats["alice"].Multiplier)
+	}
+	hit(3, MoleCell, 0)
+	if game.board.Scores["alice"] != 8 {
+		t.Errorf("want 2 points and a reaction bonus of 2, got %d in total", game.board.Scores["alice"])
+	}
+	hit(4, RabbitCell, time.Second)
+	combo := game.board.Stats["alice"]
+	if combo.Streak != 0 || combo.Multiplier != 1 || combo.BestStreak != 4 {
+		t.Errorf("want streak broken by the rabbit and best streak 4, got %+v", combo)
+	}
+}
+
+func TestMissesAndSpamArePenalised(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 3, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	now := time.Now().UnixNano()
+	for i := 0; i < 5; i++ {
+		err := game.AddAction(now+int64(i), "alice", "v")
+		if i < 4 && err != nil {
+			t.Fatalf("want hit %d queued, got %v", i, err)
+		}
+		if i == 4 && !errors.Is(err, ErrorRateLimited) {
+			t.Errorf("want %v once the round is full, got %v", ErrorRateLimited, err)
+		}
+	}
+	game.resolveHits()
+	if game.board.Scores["alice"] != 0 || game.statsFor("alice").misses != 4 {
+		t.Errorf("want 4 misses taking alice down to 0, got %d points and %d misses", game.board.Scores["alice"], game.statsFor("alice").misses)
+	}
+
+	var err error
+	for i := 0; i < defaultInput.MaxActionsPerSecond+1 && err == nil; i++ {
+		err = game.AddAction(now+int64(i*int(time.Millisecond)), "bob", "v")
+		game.actions = []Action{}
+	}
+	if !errors.Is(err, ErrorImpossibleInput) {
+		t.Errorf("want %v, got %v", ErrorImpossibleInput, err)
+	}
+}
+
+func TestFirstHitClaimsMole(t *testing.T) {
+	t.Parallel()
+	alice := &Session{Id: "alice", out: make(chan []byte, 8)}
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	game.sessions = []*Session{alice}
+	mole := game.spawnTarget(2, MoleCell, time.Minute)
+	now := mole.spawnedAt.Add(time.Second).UnixNano()
+	game.AddAction(now+500, "alice", "r")
+	game.AddAction(now, "bob", "r")
+	game.transitionGameState()
+	if game.board.Scores["bob"] != 1 || game.board.Scores["alice"] != 0 {
+		t.Errorf("want only bob to score, got %v", game.board.Scores)
+	}
+	var envelope Envelope
+	for envelope.Type != MessageTooLate && len(alice.out) > 0 {
+		json.Unmarshal(<-alice.out, &envelope)
+	}
+	if envelope.Type != MessageTooLate {
+		t.Errorf("want alice told %s", MessageTooLate)
+	}
+}
+
+func TestSameSeedSameBoards(t *testing.T) {
+	t.Parallel()
+	scores := func() map[string]int64 { return map[string]int64{"alice": 0, "bob": 0} }
+	healths := func() map[string]int64 { return map[string]int64{"alice": 3, "bob": 3} }
+	first, second := newTestGame(scores(), healths()), newTestGame(scores(), healths())
+	first.spawner, second.spawner = HotCellSpawner{HotCells: []int{4}}, HotCellSpawner{HotCells: []int{4}}
+	for round := 1; round <= 20; round++ {
+		first.clearTargets(DespawnCleared)
+		second.clearTargets(DespawnCleared)
+		first.transitionGameState()
+		second.transitionGameState()
+		if !reflect.DeepEqual(first.board.BoardState, second.board.BoardState) {
+			t.Fatalf("round %d: want %v, got %v", round, first.board.BoardState, second.board.BoardState)
+		}
+	}
+	first.endGame("alice", EndReasonTimeout)
+	if first.result.Seed != 1 {
+		t.Errorf("want seed 1 in result, got %d", first.result.Seed)
+	}
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// CloseReason tells the players of a room why it was closed
+type CloseReason string
+
+const (
+	CloseReasonHost      CloseReason = "closedByHost"
+	CloseReasonFinished  CloseReason = "finished"
+	CloseReasonAbandoned CloseReason = "abandoned"
+)
+
+// How long the host's early start waits before the game starts
+const countdownDuration = 3 * time.Second
+
+// transferHost hands the room over to the longest standing player, nobody if
+// the room is empty
+func (g *Game) transferHost() {
+	g.host = ""
+	if len(g.players) > 0 {
+		g.host = g.players[0]
+		log.Printf("Player %s is now the host of %s", g.host, g.Id)
+	}
+}
+
+// checkCountdown cancels the countdown once too few players are ready
+func (g *Game) checkCountdown() {
+	if !g.countdownEnds.IsZero() && len(g.playerReady) < g.minPlayers {
+		g.countdownEnds = time.Time{}
+		g.broadcast(MessageCountdown, CountdownMessage{Cancelled: true})
+	}
+}
+
+// SetConfig changes the settings of the room on behalf of the host, only
+// allowed before the game starts. Players have to get ready again
+func (g *Game) SetConfig(hostId string, config GameConfig) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hostId != g.host {
+		return ErrorNotHost
+	}
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return ErrorGameInProgress
+	}
+	config = config.normalize()
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if config.MaxPlayers < len(g.players) {
+		return fmt.Errorf("%w: %d players are already in the room", ErrorInvalidArguments, len(g.players))
+	}
+	g.applyConfig(config)
+	g.playerReady = []string{}
+	g.checkCountdown()
+	if len(g.players) < g.minPlayers {
+		g.setState(WaitEnoughPlayers)
+		return nil
+	}
+	g.broadcastLobby()
+	return nil
+}
+
+// SetLocked locks or unlocks the room on behalf of the host
+func (g *Game) SetLocked(hostId string, locked bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hostId != g.host {
+		return ErrorNotHost
+	}
+	g.locked = locked
+	g.broadcastLobby()
+	return nil
+}
+
+// StartCountdown starts the game after countdownDuration on behalf of the
+// host, without waiting for every player to get ready
+func (g *Game) StartCountdown(hostId string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hostId != g.host {
+		return ErrorNotHost
+	}
+	if g.state != WaitEnoughPlayers && g.state != WaitPlayersReady {
+		return ErrorGameInProgress
+	}
+	if len(g.playerReady) < g.minPlayers {
+		return fmt.Errorf("%w: %d of %d", ErrorNotEnoughReady, len(g.playerReady), g.minPlayers)
+	}
+	g.countdownEnds = time.Now().Add(countdownDuration)
+	g.broadcast(MessageCountdown, CountdownMessage{StartsInMs: countdownDuration.Milliseconds()})
+	return nil
+}
+
+// Close closes the room on behalf of the host
+func (g *Game) Close(hostId string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hostId != g.host {
+		return ErrorNotHost
+	}
+	g.close(CloseReasonHost)
+	return nil
+}
+
+// Closed reports whether the room has been closed
+func (g *Game) Closed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closed
+}
+
+// close tells every session the room is gone and empties it. The engine
+// stops on its next tick
+func (g *Game) close(reason CloseReason) {
+	if g.closed {
+		return
+	}
+	g.broadcast(MessageRoomClosed, RoomClosedMessage{Room: g.Id, Reason: reason})
+	g.closed = true
+	g.players = []string{}
+	g.playerReady = []string{}
+	g.sessions = []*Session{}
+	log.Printf("Room %s closed (%s)", g.Id, reason)
+}
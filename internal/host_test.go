@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestLobby returns a room of up to three players, hosted by alice
+func newTestLobby(players ...string) *Game {
+	config := DefaultGameConfig()
+	config.MaxPlayers = 3
+	game := newGame("lobby", config, []string{}, []*Session{})
+	for _, id := range players {
+		game.AddPlayer(id, &Session{Id: id, out: make(chan []byte, 32)}, "")
+	}
+	return game
+}
+
+func TestHostTransfer(t *testing.T) {
+	t.Parallel()
+	game := newTestLobby("alice", "bob", "carol")
+	if game.Summary().Host != "alice" {
+		t.Fatalf("want alice hosting, got %q", game.Summary().Host)
+	}
+	game.RemovePlayer("alice")
+	if host := game.Summary().Host; host != "bob" {
+		t.Errorf("want bob hosting after alice left, got %q", host)
+	}
+}
+
+func TestHostCommands(t *testing.T) {
+	t.Parallel()
+	game := newTestLobby("alice", "bob")
+	if err := game.SetLocked("bob", true); err != ErrorNotHost {
+		t.Errorf("want %v, got %v", ErrorNotHost, err)
+	}
+	game.SetLocked("alice", true)
+	if err := game.AddPlayer("carol", &Session{Id: "carol"}, ""); err != ErrorRoomLocked {
+		t.Errorf("want %v, got %v", ErrorRoomLocked, err)
+	}
+	game.SetLocked("alice", false)
+
+	config := DefaultGameConfig()
+	config.DurationMs = 30000
+	if err := game.SetConfig("alice", config); err != nil {
+		t.Fatalf("want config changed, got %v", err)
+	}
+	if game.Config().DurationMs != 30000 {
+		t.Errorf("want new duration, got %+v", game.Config())
+	}
+	config.MaxPlayers = 1
+	if err := game.SetConfig("alice", config); !errors.Is(err, ErrorInvalidArguments) {
+		t.Errorf("want config rejected, got %v", err)
+	}
+
+	if err := game.Close("alice"); err != nil {
+		t.Fatalf("want room closed, got %v", err)
+	}
+	if over := game.tick(); !over || game.HasPlayer("bob") {
+		t.Errorf("want engine stopped and bob out of the room, got %v", game.Players())
+	}
+}
+
+func TestCountdownStartsGameEarly(t *testing.T) {
+	t.Parallel()
+	game := newTestLobby("alice", "bob", "carol")
+	game.tick()
+	game.AddPlayerReady("alice")
+	if err := game.StartCountdown("alice"); !errors.Is(err, ErrorNotEnoughReady) {
+		t.Errorf("want %v, got %v", ErrorNotEnoughReady, err)
+	}
+	game.AddPlayerReady("bob")
+	if err := game.StartCountdown("alice"); err != nil {
+		t.Fatalf("want countdown started, got %v", err)
+	}
+	game.mu.Lock()
+	game.countdownEnds = time.Now()
+	game.mu.Unlock()
+	game.tick()
+	if game.State() != Running {
+		t.Errorf("want game started without carol being ready, got %s", game.State())
+	}
+}
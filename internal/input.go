@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// InputRules limits how fast a player can send hits. Hits over the limits
+// are rejected and reported back to the player instead of being queued
+type InputRules struct {
+	// Hits a player can queue before the engine resolves them on its next tick
+	MaxActionsPerRound int `json:"maxActionsPerRound"`
+	// No human hits faster than this, anything above it is a script
+	MaxActionsPerSecond int `json:"maxActionsPerSecond"`
+}
+
+var defaultInput = InputRules{MaxActionsPerRound: 4, MaxActionsPerSecond: 20}
+
+// checkInput rejects a hit by playerId at ts that goes over the input rules
+func (g *Game) checkInput(playerId string, ts int64) error {
+	queued := 0
+	for _, item := range g.actions {
+		if item.id == playerId {
+			queued += 1
+		}
+	}
+	if queued >= g.input.MaxActionsPerRound {
+		return fmt.Errorf("%w: at most %d hits per round", ErrorRateLimited, g.input.MaxActionsPerRound)
+	}
+	if g.recentInputs == nil {
+		g.recentInputs = map[string][]int64{}
+	}
+	// Rejected hits still count, so a script keeps getting flagged
+	recent := []int64{ts}
+	for _, prev := range g.recentInputs[playerId] {
+		if ts-prev < int64(time.Second) {
+			recent = append(recent, prev)
+		}
+	}
+	g.recentInputs[playerId] = recent
+	if len(recent) > g.input.MaxActionsPerSecond {
+		g.statsFor(playerId).flagged += 1
+		return fmt.Errorf("%w: %d hits in the last second", ErrorImpossibleInput, len(recent))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"log"
+	"time"
+)
+
+// RoomLifecycle decides when finished and abandoned rooms are closed and
+// taken out of the registry
+type RoomLifecycle struct {
+	// How long the results of a game stay up once it is over
+	FinishedAfter time.Duration
+	// How long a room stays up once the last session left it, or after it
+	// was created without anyone in it
+	AbandonedAfter time.Duration
+	// How often the registry looks for rooms to close
+	SweepInterval time.Duration
+}
+
+// DefaultRoomLifecycle is used by the server unless overridden by its flags
+var DefaultRoomLifecycle = RoomLifecycle{
+	FinishedAfter:  5 * time.Minute,
+	AbandonedAfter: time.Minute,
+	SweepInterval:  10 * time.Second,
+}
+
+// expire closes the room if it has been over or empty for long enough and
+// reports whether it is closed
+func (g *Game) expire(now time.Time, lifecycle RoomLifecycle) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case g.state == Over && now.Sub(g.overAt) >= lifecycle.FinishedAfter:
+		g.close(CloseReasonFinished)
+	case len(g.sessions) == 0 && now.Sub(g.emptySince) >= lifecycle.AbandonedAfter:
+		g.close(CloseReasonAbandoned)
+	}
+	return g.closed
+}
+
+// Evict closes the rooms that are finished or abandoned at now and takes
+// them out of the registry along with rooms closed by their host. It
+// returns the names of the evicted rooms
+func (r *Rooms) Evict(now time.Time, lifecycle RoomLifecycle) []string {
+	evicted := []string{}
+	for _, game := range r.List() {
+		if game.expire(now, lifecycle) {
+			r.Remove(game)
+			evicted = append(evicted, game.Id)
+		}
+	}
+	return evicted
+}
+
+// Manage evicts rooms every SweepInterval until stop is closed, forever if
+// stop is nil. The engine of an evicted room returns on its next tick
+func (r *Rooms) Manage(lifecycle RoomLifecycle, stop <-chan struct{}) {
+	ticker := time.NewTicker(lifecycle.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if evicted := r.Evict(now, lifecycle); len(evicted) > 0 {
+				log.Printf("Evicted rooms %v", evicted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
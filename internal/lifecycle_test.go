@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvictFinishedRooms(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	alice := &Session{Id: "alice", out: make(chan []byte, 32)}
+	game, _, _ := rooms.GetOrCreate("lobby", func() (*Game, error) {
+		return newGame("lobby", DefaultGameConfig(), []string{"alice"}, []*Session{alice}), nil
+	})
+	game.mu.Lock()
+	game.setState(Over)
+	game.mu.Unlock()
+
+	now := time.Now()
+	if evicted := rooms.Evict(now, DefaultRoomLifecycle); len(evicted) != 0 {
+		t.Errorf("want results kept up for a while, got %v evicted", evicted)
+	}
+	evicted := rooms.Evict(now.Add(DefaultRoomLifecycle.FinishedAfter), DefaultRoomLifecycle)
+	if !reflect.DeepEqual(evicted, []string{"lobby"}) {
+		t.Fatalf("want lobby evicted, got %v", evicted)
+	}
+	if _, ok := rooms.Get("lobby"); ok || game.HasPlayer("alice") {
+		t.Errorf("want lobby out of the registry and empty")
+	}
+	var envelope Envelope
+	for envelope.Type != MessageRoomClosed && len(alice.out) > 0 {
+		json.Unmarshal(<-alice.out, &envelope)
+	}
+	var closed RoomClosedMessage
+	json.Unmarshal(envelope.Payload, &closed)
+	if closed.Reason != CloseReasonFinished {
+		t.Errorf("want alice told the room finished, got %+v", closed)
+	}
+}
+
+func TestEvictAbandonedRooms(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	for _, name := range []string{"empty", "busy"} {
+		name := name
+		rooms.GetOrCreate(name, func() (*Game, error) {
+			return newGame(name, DefaultGameConfig(), []string{}, []*Session{}), nil
+		})
+	}
+	busy, _ := rooms.Get("busy")
+	busy.AddPlayer("alice", &Session{Id: "alice", out: make(chan []byte, 32)}, "")
+	busy.tick()
+
+	later := time.Now().Add(DefaultRoomLifecycle.AbandonedAfter)
+	if evicted := rooms.Evict(later, DefaultRoomLifecycle); !reflect.DeepEqual(evicted, []string{"empty"}) {
+		t.Errorf("want only the empty room evicted, got %v", evicted)
+	}
+
+	busy.RemovePlayer("alice")
+	if evicted := rooms.Evict(time.Now(), DefaultRoomLifecycle); len(evicted) != 0 {
+		t.Errorf("want busy kept up right after alice left, got %v evicted", evicted)
+	}
+	later = time.Now().Add(DefaultRoomLifecycle.AbandonedAfter)
+	if evicted := rooms.Evict(later, DefaultRoomLifecycle); !reflect.DeepEqual(evicted, []string{"busy"}) {
+		t.Errorf("want busy evicted once abandoned, got %v", evicted)
+	}
+	if over := busy.tick(); !over {
+		t.Errorf("want the engine of busy stopped")
+	}
+}
+
+func TestClosedRoomsAreReplaced(t *testing.T) {
+	t.Parallel()
+	rooms := NewRooms()
+	create := func() (*Game, error) {
+		return newGame("lobby", DefaultGameConfig(), []string{}, []*Session{}), nil
+	}
+	closed, _, _ := rooms.GetOrCreate("lobby", create)
+	closed.mu.Lock()
+	closed.close(CloseReasonAbandoned)
+	closed.mu.Unlock()
+	game, created, err := rooms.GetOrCreate("lobby", create)
+	if err != nil || !created || game == closed {
+		t.Errorf("want a new lobby in place of the closed one, got created %v, %v", created, err)
+	}
+	rooms.Remove(closed)
+	if current, _ := rooms.Get("lobby"); current != game {
+		t.Errorf("want the new lobby kept when the closed one is removed")
+	}
+}
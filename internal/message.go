@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+)
+
+// ProtocolVersion is bumped whenever a payload changes in a way older clients
+// cannot handle
+const ProtocolVersion = 1
+
+// MessageType tells clients how to decode the payload of an Envelope
+type MessageType string
+
+const (
+	MessageAck         MessageType = "ack"
+	MessageError       MessageType = "error"
+	MessageRoom        MessageType = "room"
+	MessageRoomList    MessageType = "roomList"
+	MessageGameStarted MessageType = "gameStarted"
+	MessageBoard       MessageType = "board"
+	MessageSpawn       MessageType = "spawn"
+	MessageDespawn     MessageType = "despawn"
+	MessageTiebreak    MessageType = "tiebreak"
+	MessageEliminated  MessageType = "eliminated"
+	MessageTooLate     MessageType = "tooLate"
+	MessageFrozen      MessageType = "frozen"
+	MessageMiss        MessageType = "miss"
+	MessageKicked      MessageType = "kicked"
+	MessageCountdown   MessageType = "countdown"
+	MessageRoomClosed  MessageType = "roomClosed"
+	MessageResult      MessageType = "result"
+)
+
+// Envelope wraps every message sent from the server to a client
+type Envelope struct {
+	Type    MessageType     `json:"type"`
+	Version int             `json:"version"`
+	Seq     uint64          `json:"seq"`
+	Payload json.RawMessage `json:"payload"`
+	// Id of the request this message answers, empty for pushed messages
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// AckMessage confirms that a request was received
+type AckMessage struct{}
+
+// ErrorCode lets clients handle a rejected request without parsing the message
+type ErrorCode string
+
+const (
+	ErrorCodeMalformedRequest ErrorCode = "malformedRequest"
+	ErrorCodeUnknownCommand   ErrorCode = "unknownCommand"
+	ErrorCodeInvalidArguments ErrorCode = "invalidArguments"
+	ErrorCodeRoomFull         ErrorCode = "roomFull"
+	ErrorCodeNotInRoom        ErrorCode = "notInRoom"
+	ErrorCodeGameNotRunning   ErrorCode = "gameNotRunning"
+	ErrorCodeGameInProgress   ErrorCode = "gameInProgress"
+	ErrorCodeFrozen           ErrorCode = "frozen"
+	ErrorCodeRateLimited      ErrorCode = "rateLimited"
+	ErrorCodeImpossibleInput  ErrorCode = "impossibleInput"
+	ErrorCodeNotHost          ErrorCode = "notHost"
+	ErrorCodeRoomLocked       ErrorCode = "roomLocked"
+	ErrorCodeRoomClosed       ErrorCode = "roomClosed"
+	ErrorCodeNotEnoughReady   ErrorCode = "notEnoughReady"
+	ErrorCodeWrongCredentials ErrorCode = "wrongCredentials"
+	ErrorCodeInternal         ErrorCode = "internal"
+)
+
+var errorCodes = map[error]ErrorCode{
+	ErrorMalformedRequest:  ErrorCodeMalformedRequest,
+	ErrorUnknownCommand:    ErrorCodeUnknownCommand,
+	ErrorInvalidArguments:  ErrorCodeInvalidArguments,
+	ErrorMaxPlayersReached: ErrorCodeRoomFull,
+	ErrorNotInRoom:         ErrorCodeNotInRoom,
+	ErrorGameNotRunning:    ErrorCodeGameNotRunning,
+	ErrorGameInProgress:    ErrorCodeGameInProgress,
+	ErrorFrozen:            ErrorCodeFrozen,
+	ErrorRateLimited:       ErrorCodeRateLimited,
+	ErrorImpossibleInput:   ErrorCodeImpossibleInput,
+	ErrorNotHost:           ErrorCodeNotHost,
+	ErrorRoomLocked:        ErrorCodeRoomLocked,
+	ErrorRoomClosed:        ErrorCodeRoomClosed,
+	ErrorNotEnoughReady:    ErrorCodeNotEnoughReady,
+	ErrorWrongCredentials:  ErrorCodeWrongCredentials,
+}
+
+// ErrorMessage reports a request the server could not fulfil
+type ErrorMessage struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Command of the rejected request, empty if it could not be parsed
+	Command string `json:"command"`
+}
+
+// newErrorMessage maps err onto the code of the sentinel error it wraps
+func newErrorMessage(command string, err error) ErrorMessage {
+	code := ErrorCodeInternal
+	for sentinel, c := range errorCodes {
+		if errors.Is(err, sentinel) {
+			code = c
+			break
+		}
+	}
+	return ErrorMessage{Code: code, Message: err.Error(), Command: command}
+}
+
+// RoomListMessage answers the list command
+type RoomListMessage struct {
+	Rooms []GameRoomStream `json:"rooms"`
+}
+
+// GameStartedMessage is sent once every player in the room is ready
+type GameStartedMessage struct {
+	Room string `json:"room"`
+}
+
+// TiebreakMessage is sent when the game ends in a tie, only the listed
+// players may hit the super mole
+type TiebreakMessage struct {
+	Players []string `json:"players"`
+}
+
+// EliminatedMessage is sent to a player whose health reached zero
+type EliminatedMessage struct {
+	Player string `json:"player"`
+}
+
+// TooLateMessage is sent to a player who hit a mole already claimed by
+// another player
+type TooLateMessage struct {
+	Key       string `json:"key"`
+	ClaimedBy string `json:"claimedBy"`
+}
+
+// KickedMessage is sent to a player the host kicked out of the room
+type KickedMessage struct {
+	Room string `json:"room"`
+	By   string `json:"by"`
+}
+
+// CountdownMessage is sent when the host starts the game early, the game
+// starts once the countdown runs out
+type CountdownMessage struct {
+	StartsInMs int64 `json:"startsInMs"`
+	// Set when too few players are left ready for the game to start
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// RoomClosedMessage is sent to every session left in a room that is closed
+type RoomClosedMessage struct {
+	Room   string      `json:"room"`
+	Reason CloseReason `json:"reason"`
+}
+
+// MissMessage is sent to a player who hit an empty cell
+type MissMessage struct {
+	Key string `json:"key"`
+	// Points taken off the score of the player
+	Penalty int64 `json:"penalty"`
+}
+
+// FrozenMessage is sent to the players who cannot hit anything for a while
+// because another player hit a freeze
+type FrozenMessage struct {
+	By         string `json:"by"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// SpawnMessage is pushed as soon as a target appears on the board
+type SpawnMessage struct {
+	Target int    `json:"target"`
+	Cell   int    `json:"cell"`
+	Key    string `json:"key"`
+	// Cell value the target shows up as in GameBoard.Board
+	Kind   int    `json:"kind"`
+	Marker string `json:"marker"`
+	// How long the target stays unless hit, 0 if it stays until hit
+	LifetimeMs  int64 `json:"lifetimeMs"`
+	SpawnedAtMs int64 `json:"spawnedAtMs"`
+}
+
+// DespawnMessage is pushed as soon as a target leaves the board
+type DespawnMessage struct {
+	Target int           `json:"target"`
+	Cell   int           `json:"cell"`
+	Key    string        `json:"key"`
+	Reason DespawnReason `json:"reason"`
+	// Player who claimed the target, set when Reason is hit
+	HitBy string `json:"hitBy,omitempty"`
+}
+
+// send pushes a message to the client that does not answer any request
+func (s *Session) send(msgType MessageType, payload interface{}) {
+	s.sendEnvelope("", msgType, payload)
+}
+
+// reply answers the request currently handled by the session. Must only be
+// called from the session goroutine
+func (s *Session) reply(msgType MessageType, payload interface{}) {
+	s.sendEnvelope(s.requestId, msgType, payload)
+}
+
+// sendEnvelope wraps the payload in an Envelope and queues it for the client.
+// Sequence numbers are per session and start from 1
+func (s *Session) sendEnvelope(requestId string, msgType MessageType, payload interface{}) {
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode %s message: %v", msgType, err)
+		return
+	}
+	encodedEnvelope, _ := json.Marshal(Envelope{
+		Type:      msgType,
+		Version:   ProtocolVersion,
+		Seq:       atomic.AddUint64(&s.seq, 1),
+		Payload:   encodedPayload,
+		RequestId: requestId,
+	})
+	// Never block the game loop on a slow client, drop the message instead
+	select {
+	case s.out <- encodedEnvelope:
+	default:
+		log.Printf("Dropped %s message for %s, outbound buffer is full", msgType, s.Id)
+	}
+}
+
+func (g *Game) broadcast(msgType MessageType, payload interface{}) {
+	for _, s := range g.sessions {
+		s.send(msgType, payload)
+	}
+}
+
+// sendTo sends a message to the sessions of a single player
+func (g *Game) sendTo(playerId string, msgType MessageType, payload interface{}) {
+	for _, s := range g.sessions {
+		if s.Id == playerId {
+			s.send(msgType, payload)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSendWrapsEnvelope(t *testing.T) {
+	t.Parallel()
+	session := &Session{out: make(chan []byte, 2)}
+	session.send(MessageAck, AckMessage{})
+	session.send(MessageGameStarted, GameStartedMessage{Room: "lobby"})
+	<-session.out
+
+	var envelope Envelope
+	if err := json.Unmarshal(<-session.out, &envelope); err != nil {
+		t.Fatalf("want envelope, got error %v", err)
+	}
+	if envelope.Type != MessageGameStarted || envelope.Version != ProtocolVersion || envelope.Seq != 2 {
+		t.Errorf("want gameStarted v%d seq 2, got %s v%d seq %d", ProtocolVersion, envelope.Type, envelope.Version, envelope.Seq)
+	}
+	var payload GameStartedMessage
+	json.Unmarshal(envelope.Payload, &payload)
+	if payload.Room != "lobby" {
+		t.Errorf("want room lobby, got %s", payload.Room)
+	}
+}
+
+func TestReplyEchoesRequestId(t *testing.T) {
+	t.Parallel()
+	session := &Session{out: make(chan []byte, 2), rooms: NewRooms()}
+	if _, err := session.parseCommand(`{"command": "list", "requestId": "abc"}`); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	session.send(MessageAck, AckMessage{})
+
+	var reply, pushed Envelope
+	json.Unmarshal(<-session.out, &reply)
+	json.Unmarshal(<-session.out, &pushed)
+	if reply.Type != MessageRoomList || reply.RequestId != "abc" {
+		t.Errorf("want roomList reply to abc, got %s reply to %q", reply.Type, reply.RequestId)
+	}
+	if pushed.RequestId != "" {
+		t.Errorf("want pushed message without request id, got %q", pushed.RequestId)
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+)
+
+// GameMode decides how a running game is scored and when it is over. The
+// game consults its mode on every tick, once hits are resolved and players
+// out of health are eliminated
+type GameMode interface {
+	// Score returns the points for a scoring hit, given the score of the
+	// target and the points the scoring rules award for it
+	Score(base int64, points int64) int64
+	// TimeLeftMs is shown to clients as GameBoard.GameTime, -1 if the mode
+	// has no timer
+	TimeLeftMs(g *Game, elapsedMs int64) int64
+	// Check returns why the game is over, if it is. The winner is the leader
+	// among the players still standing
+	Check(g *Game, elapsedMs int64) (EndReason, bool)
+}
+
+// Built-in game modes, selected with ModeSettings.Name
+const (
+	ModeTimed       = "timed"
+	ModeSurvival    = "survival"
+	ModeRace        = "race"
+	ModeElimination = "elimination"
+)
+
+// Shortest round of the elimination mode
+const minEliminationRoundMs = 5000
+
+// ModeSettings selects the game mode of a room and its parameters
+type ModeSettings struct {
+	Name string `json:"name"`
+	// Points to reach in the race mode
+	Target int64 `json:"target,omitempty"`
+	// Length of a round in the elimination mode
+	RoundMs int64 `json:"roundMs,omitempty"`
+}
+
+var defaultModeSettings = ModeSettings{Name: ModeTimed}
+
+func newGameMode(settings ModeSettings) (GameMode, error) {
+	switch settings.Name {
+	case "", ModeTimed:
+		return TimedMode{}, nil
+	case ModeSurvival:
+		return SurvivalMode{}, nil
+	case ModeRace:
+		if settings.Target < 1 {
+			return nil, fmt.Errorf("%w: race needs a target of at least one point", ErrorInvalidArguments)
+		}
+		return RaceMode{Target: settings.Target}, nil
+	case ModeElimination:
+		if settings.RoundMs < minEliminationRoundMs {
+			return nil, fmt.Errorf("%w: elimination rounds must last at least %d ms", ErrorInvalidArguments, minEliminationRoundMs)
+		}
+		return &EliminationMode{RoundMs: settings.RoundMs}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown game mode %q", ErrorInvalidArguments, settings.Name)
+	}
+}
+
+// lastStanding ends every mode once at most one player is left
+func lastStanding(g *Game) (EndReason, bool) {
+	return EndReasonLastStanding, len(g.alivePlayers()) <= 1
+}
+
+// TimedMode is a score attack, the highest score when the timer runs out wins
+type TimedMode struct{}
+
+func (TimedMode) Score(base int64, points int64) int64 {
+	return points
+}
+
+func (TimedMode) TimeLeftMs(g *Game, elapsedMs int64) int64 {
+	return g.gameDurationMs - elapsedMs
+}
+
+func (TimedMode) Check(g *Game, elapsedMs int64) (EndReason, bool) {
+	if reason, over := lastStanding(g); over {
+		return reason, over
+	}
+	return EndReasonTimeout, elapsedMs >= g.gameDurationMs
+}
+
+// SurvivalMode has no timer, the last player with health left wins. Every
+// scoring hit is worth its base score, streaks and reaction do not count
+type SurvivalMode struct{}
+
+func (SurvivalMode) Score(base int64, points int64) int64 {
+	return base
+}
+
+func (SurvivalMode) TimeLeftMs(g *Game, elapsedMs int64) int64 {
+	return -1
+}
+
+func (SurvivalMode) Check(g *Game, elapsedMs int64) (EndReason, bool) {
+	return lastStanding(g)
+}
+
+// RaceMode is won by the first player to reach Target points. The game
+// duration caps the race, the leader wins if nobody gets there in time
+type RaceMode struct {
+	Target int64
+}
+
+func (RaceMode) Score(base int64, points int64) int64 {
+	return points
+}
+
+func (RaceMode) TimeLeftMs(g *Game, elapsedMs int64) int64 {
+	return g.gameDurationMs - elapsedMs
+}
+
+func (r RaceMode) Check(g *Game, elapsedMs int64) (EndReason, bool) {
+	for _, id := range g.alivePlayers() {
+		if g.board.Scores[id] >= r.Target {
+			return EndReasonTargetReached, true
+		}
+	}
+	return TimedMode{}.Check(g, elapsedMs)
+}
+
+// EliminationMode drops the players who scored the least at the end of each
+// round of RoundMs, until one player is left. Tied rounds eliminate nobody,
+// so the game duration caps the game like it caps a race. Each game needs
+// its own instance
+type EliminationMode struct {
+	RoundMs int64
+	round   int64
+	// Scores at the start of the current round
+	baseline map[string]int64
+}
+
+func (*EliminationMode) Score(base int64, points int64) int64 {
+	return points
+}
+
+// TimeLeftMs counts down to the end of the round, or of the game if it ends
+// first
+func (e *EliminationMode) TimeLeftMs(g *Game, elapsedMs int64) int64 {
+	left := e.RoundMs - elapsedMs%e.RoundMs
+	if gameLeft := g.gameDurationMs - elapsedMs; gameLeft < left {
+		left = gameLeft
+	}
+	return left
+}
+
+func (e *EliminationMode) Check(g *Game, elapsedMs int64) (EndReason, bool) {
+	if e.baseline == nil {
+		e.baseline = copyScores(g.board.Scores)
+	}
+	if round := elapsedMs / e.RoundMs; round > e.round {
+		e.round = round
+		e.eliminateLowest(g)
+		e.baseline = copyScores(g.board.Scores)
+	}
+	return TimedMode{}.Check(g, elapsedMs)
+}
+
+// eliminateLowest eliminates the players who scored the least this round,
+// nobody if every player scored the same
+func (e *EliminationMode) eliminateLowest(g *Game) {
+	alive := g.alivePlayers()
+	lowest := []string{}
+	for _, id := range alive {
+		gain := g.board.Scores[id] - e.baseline[id]
+		if len(lowest) == 0 || gain < g.board.Scores[lowest[0]]-e.baseline[lowest[0]] {
+			lowest = []string{id}
+		} else if gain == g.board.Scores[lowest[0]]-e.baseline[lowest[0]] {
+			lowest = append(lowest, id)
+		}
+	}
+	if len(lowest) == len(alive) {
+		log.Printf("Round %d tied, nobody is eliminated", e.round)
+		return
+	}
+	for _, id := range lowest {
+		g.eliminate(id)
+	}
+}
+
+func copyScores(scores map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(scores))
+	for id, score := range scores {
+		copied[id] = score
+	}
+	return copied
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRaceModeEndsAtTarget(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 9, "bob": 4}, map[string]int64{"alice": 3, "bob": 3})
+	game.mode = RaceMode{Target: 10}
+	game.transitionGameState()
+	if game.state != Running {
+		t.Fatalf("want race running below the target, got %s", game.state)
+	}
+	game.board.Scores["alice"] = 10
+	game.transitionGameState()
+	if game.state != Over || game.winner != "alice" || game.result.Reason != EndReasonTargetReached {
+		t.Errorf("want alice to win the race, got %s won by %q", game.state, game.winner)
+	}
+}
+
+func TestSurvivalModeHasNoTimer(t *testing.T) {
+	t.Parallel()
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	game.mode = SurvivalMode{}
+	game.startTime = time.Now().Add(-time.Hour)
+	game.transitionGameState()
+	if game.state != Running || game.board.GameTime != -1 {
+		t.Errorf("want survival running with no time left shown, got %s with %d ms", game.state, game.board.GameTime)
+	}
+	if points := game.mode.Score(1, 8); points != 1 {
+		t.Errorf("want base score in survival, got %d", points)
+	}
+}
+
+func TestEliminationModeDropsLowestScorer(t *testing.T) {
+	t.Parallel()
+	mode := &EliminationMode{RoundMs: minEliminationRoundMs}
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0, "carol": 0}, map[string]int64{"alice": 3, "bob": 3, "carol": 3})
+	game.mode = mode
+	mode.Check(game, 0)
+	game.board.Scores["alice"], game.board.Scores["bob"] = 2, 1
+	if _, over := mode.Check(game, minEliminationRoundMs); over || !contains(game.eliminated, "carol") {
+		t.Fatalf("want carol out after round 1, got eliminated %v", game.eliminated)
+	}
+	if _, over := mode.Check(game, 2*minEliminationRoundMs); over {
+		t.Fatalf("want a tied round to eliminate nobody, got eliminated %v", game.eliminated)
+	}
+	game.board.Scores["alice"] = 3
+	if reason, over := mode.Check(game, 3*minEliminationRoundMs); !over || reason != EndReasonLastStanding {
+		t.Errorf("want game over with alice standing, got %v %s", over, reason)
+	}
+}
+
+func TestEliminationModeEndsWithTheGameDuration(t *testing.T) {
+	t.Parallel()
+	mode := &EliminationMode{RoundMs: minEliminationRoundMs}
+	game := newTestGame(map[string]int64{"alice": 0, "bob": 0}, map[string]int64{"alice": 3, "bob": 3})
+	game.mode = mode
+	if left := mode.TimeLeftMs(game, game.gameDurationMs-1000); left != 1000 {
+		t.Errorf("want the last round cut short by the game duration, got %d ms left", left)
+	}
+	if reason, over := mode.Check(game, game.gameDurationMs); !over || reason != EndReasonTimeout {
+		t.Errorf("want tied rounds to end with the game duration, got %v %s", over, reason)
+	}
+}
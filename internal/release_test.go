@@ -0,0 +1,22 @@
+//go:build !debug
+// +build !debug
+
+package internal
+
+import "testing"
+
+func TestDebugRequestsRejected(t *testing.T) {
+	t.Parallel()
+	session := &Session{rooms: NewRooms()}
+	cases := map[string]ErrorCode{
+		`{"command": "join", "payload": {"roomName": "zoo", "seed": 1}}`: ErrorCodeInvalidArguments,
+		`{"command": "init"}`:                          ErrorCodeUnknownCommand,
+		`{"command": "send", "payload": {"key": "d"}}`: ErrorCodeUnknownCommand,
+	}
+	for msg, want := range cases {
+		socketRequest, err := session.parseCommand(msg)
+		if got := newErrorMessage(socketRequest.Command, err).Code; err == nil || got != want {
+			t.Errorf("%q: want code %s, got %v", msg, want, err)
+		}
+	}
+}
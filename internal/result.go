@@ -0,0 +1,118 @@
+package internal
+
+import "sort"
+
+// EndReason describes why a game ended
+type EndReason string
+
+const (
+	EndReasonTimeout      EndReason = "timeout"
+	EndReasonLastStanding EndReason = "lastStanding"
+	EndReasonTiebreak     EndReason = "tiebreak"
+	// A player reached the target of the race mode
+	EndReasonTargetReached EndReason = "targetReached"
+)
+
+// PlayerResult is the final standing of a single player
+type PlayerResult struct {
+	Id         string `json:"id"`
+	Rank       int    `json:"rank"`
+	Score      int64  `json:"score"`
+	Health     int64  `json:"health"`
+	Hits       int64  `json:"hits"`
+	RabbitHits int64  `json:"rabbitHits"`
+	BestStreak int    `json:"bestStreak"`
+	Misses     int64  `json:"misses"`
+	// Hits rejected for coming in faster than humanly possible
+	Flagged int64 `json:"flagged"`
+	// Milliseconds since the game started, omitted if the player was never eliminated
+	EliminatedAtMs int64 `json:"eliminatedAtMs,omitempty"`
+}
+
+// GameResult is broadcast to every session in the room once the game is over
+type GameResult struct {
+	Room      string         `json:"room"`
+	Winner    string         `json:"winner"`
+	Reason    EndReason      `json:"reason"`
+	Standings []PlayerResult `json:"standings"`
+	// Seed of the random number generator, replays the same boards
+	Seed int64 `json:"seed"`
+}
+
+type playerStats struct {
+	hits           int64
+	rabbitHits     int64
+	misses         int64
+	flagged        int64
+	eliminatedAtMs int64
+}
+
+func (g *Game) statsFor(playerId string) *playerStats {
+	if g.stats == nil {
+		g.stats = make(map[string]*playerStats)
+	}
+	stats, ok := g.stats[playerId]
+	if !ok {
+		stats = &playerStats{}
+		g.stats[playerId] = stats
+	}
+	return stats
+}
+
+// buildResult ranks every player on the board. The winner always comes first,
+// followed by players still standing and then eliminated players, latest
+// elimination first. Within each group players are ranked by score and health
+func (g *Game) buildResult(reason EndReason) *GameResult {
+	standings := []PlayerResult{}
+	for id, score := range g.board.Scores {
+		stats := g.statsFor(id)
+		standings = append(standings, PlayerResult{
+			Id:             id,
+			Score:          score,
+			Health:         g.board.Healths[id],
+			Hits:           stats.hits,
+			RabbitHits:     stats.rabbitHits,
+			BestStreak:     g.comboFor(id).BestStreak,
+			Misses:         stats.misses,
+			Flagged:        stats.flagged,
+			EliminatedAtMs: stats.eliminatedAtMs,
+		})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Id == g.winner || b.Id == g.winner {
+			return a.Id == g.winner
+		}
+		if g.isEliminated(a.Id) != g.isEliminated(b.Id) {
+			return !g.isEliminated(a.Id)
+		}
+		if a.EliminatedAtMs != b.EliminatedAtMs {
+			return a.EliminatedAtMs > b.EliminatedAtMs
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Health != b.Health {
+			return a.Health > b.Health
+		}
+		return a.Id < b.Id
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && standings[i-1].Id != g.winner && g.sameStanding(standings[i-1], standings[i]) {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+	return &GameResult{Room: g.Id, Winner: g.winner, Reason: reason, Standings: standings, Seed: g.seed}
+}
+
+func (g *Game) isEliminated(playerId string) bool {
+	return contains(g.eliminated, playerId)
+}
+
+func (g *Game) sameStanding(a PlayerResult, b PlayerResult) bool {
+	return g.isEliminated(a.Id) == g.isEliminated(b.Id) &&
+		a.EliminatedAtMs == b.EliminatedAtMs &&
+		a.Score == b.Score &&
+		a.Health == b.Health
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+)
+
+// Rooms is the registry of game rooms shared by every session
+type Rooms struct {
+	mu    sync.Mutex
+	games map[string]*Game
+}
+
+func NewRooms() *Rooms {
+	return &Rooms{games: make(map[string]*Game)}
+}
+
+// Get returns the room with the given name
+func (r *Rooms) Get(name string) (*Game, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	game, ok := r.games[name]
+	return game, ok
+}
+
+// GetOrCreate returns the room with the given name, creating it if it does
+// not exist yet or was closed but not removed yet. created reports whether
+// create was called
+func (r *Rooms) GetOrCreate(name string, create func() (*Game, error)) (game *Game, created bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if game, ok := r.games[name]; ok && !game.Closed() {
+		return game, false, nil
+	}
+	game, err = create()
+	if err != nil {
+		return nil, false, err
+	}
+	r.games[name] = game
+	return game, true, nil
+}
+
+// Remove takes the room out of the registry, unless another room has taken
+// its name since
+func (r *Rooms) Remove(game *Game) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.games[game.Id] == game {
+		delete(r.games, game.Id)
+	}
+}
+
+// List returns every room sorted by name
+func (r *Rooms) List() []*Game {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	games := make([]*Game, 0, len(r.games))
+	for _, game := range r.games {
+		games = append(games, game)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Id < games[j].Id
+	})
+	return games
+}
+
+// Public returns the rooms that are not private sorted by name
+func (r *Rooms) Public() []*Game {
+	games := []*Game{}
+	for _, game := range r.List() {
+		if !game.IsPrivate() {
+			games = append(games, game)
+		}
+	}
+	return games
+}
@@ -0,0 +1,82 @@
+package internal
+
+import "time"
+
+// ScoringRules decides how many points a hit is worth on top of the score of
+// its TargetType. Consecutive scoring hits build a streak that multiplies the
+// points, a miss or a hit that costs health breaks it. Hits landing soon
+// after the target spawned earn a reaction bonus, misses cost MissPenalty
+type ScoringRules struct {
+	// Scoring hits in a row needed to raise the multiplier by one
+	StreakStep    int   `json:"streakStep"`
+	MaxMultiplier int64 `json:"maxMultiplier"`
+	// Extra points for a hit right as the target spawns, shrinking to none
+	// for hits ReactionWindowMs after it
+	ReactionBonus    int64 `json:"reactionBonus"`
+	ReactionWindowMs int64 `json:"reactionWindowMs"`
+	// Points lost for hitting an empty cell
+	MissPenalty int64 `json:"missPenalty"`
+}
+
+var defaultScoring = ScoringRules{StreakStep: 3, MaxMultiplier: 4, ReactionBonus: 2, ReactionWindowMs: 500, MissPenalty: 1}
+
+// ComboStats is the streak of a single player, shown in GameBoard.Stats
+type ComboStats struct {
+	Streak     int   `json:"streak"`
+	BestStreak int   `json:"bestStreak"`
+	Multiplier int64 `json:"multiplier"`
+	// Time between the spawn of the last target hit and the hit
+	LastReactionMs int64 `json:"lastReactionMs"`
+}
+
+// multiplier returns the points multiplier for a streak
+func (r ScoringRules) multiplier(streak int) int64 {
+	if r.StreakStep <= 0 {
+		return 1
+	}
+	multiplier := 1 + int64(streak/r.StreakStep)
+	if multiplier > r.MaxMultiplier {
+		multiplier = r.MaxMultiplier
+	}
+	return multiplier
+}
+
+// reactionBonus returns the extra points for a hit reactionMs after spawn
+func (r ScoringRules) reactionBonus(reactionMs int64) int64 {
+	if reactionMs < 0 || reactionMs >= r.ReactionWindowMs {
+		return 0
+	}
+	return r.ReactionBonus * (r.ReactionWindowMs - reactionMs) / r.ReactionWindowMs
+}
+
+func (g *Game) comboFor(playerId string) *ComboStats {
+	if g.board.Stats == nil {
+		g.board.Stats = make(map[string]*ComboStats)
+	}
+	combo, ok := g.board.Stats[playerId]
+	if !ok {
+		combo = &ComboStats{Multiplier: 1}
+		g.board.Stats[playerId] = combo
+	}
+	return combo
+}
+
+// scoreHit extends the streak of playerId and returns the points earned by
+// hitting t at ts
+func (g *Game) scoreHit(playerId string, t *target, ts int64) int64 {
+	combo := g.comboFor(playerId)
+	combo.Streak += 1
+	if combo.Streak > combo.BestStreak {
+		combo.BestStreak = combo.Streak
+	}
+	combo.Multiplier = g.scoring.multiplier(combo.Streak)
+	combo.LastReactionMs = time.Unix(0, ts).Sub(t.spawnedAt).Milliseconds()
+	return targetTypes[t.kind].Score*combo.Multiplier + g.scoring.reactionBonus(combo.LastReactionMs)
+}
+
+// breakStreak resets the streak of playerId after a miss or a harmful hit
+func (g *Game) breakStreak(playerId string) {
+	combo := g.comboFor(playerId)
+	combo.Streak = 0
+	combo.Multiplier = 1
+}
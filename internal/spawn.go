@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// SpawnPolicy decides how many moles and rabbits appear each round and
+// which Spawner places them. The counts ramp up linearly from Moles and
+// Rabbits at the start of the game to MaxMoles and MaxRabbits when the timer
+// runs out, while the time targets stay on the board shrinks towards
+// MinLifetimeMs
+type SpawnPolicy struct {
+	Moles      int    `json:"moles"`
+	Rabbits    int    `json:"rabbits"`
+	MaxMoles   int    `json:"maxMoles"`
+	MaxRabbits int    `json:"maxRabbits"`
+	Strategy   string `json:"strategy,omitempty"`
+	// Cells favoured by the hotCells strategy
+	HotCells []int `json:"hotCells,omitempty"`
+	// Range of the time a target stays on the board before it hides again
+	MinLifetimeMs int64 `json:"minLifetimeMs,omitempty"`
+	MaxLifetimeMs int64 `json:"maxLifetimeMs,omitempty"`
+	// Percent chance of each special target, by TargetType name, replacing
+	// the default chance of that type
+	Specials map[string]int `json:"specials,omitempty"`
+}
+
+const (
+	defaultMinLifetimeMs = 400
+	defaultMaxLifetimeMs = 1500
+	// Targets shorter than this could expire before the engine sees the hit
+	minLifetimeMs = 100
+)
+
+var defaultSpawnPolicy = SpawnPolicy{Moles: 1, Rabbits: 1, MaxMoles: 1, MaxRabbits: 1, MinLifetimeMs: defaultMinLifetimeMs, MaxLifetimeMs: defaultMaxLifetimeMs}
+
+// normalize fills in the maximums and lifetimes left out by the client, no
+// ramp up
+func (p SpawnPolicy) normalize() SpawnPolicy {
+	if p.MaxMoles < p.Moles {
+		p.MaxMoles = p.Moles
+	}
+	if p.MaxRabbits < p.Rabbits {
+		p.MaxRabbits = p.Rabbits
+	}
+	if p.MinLifetimeMs == 0 && p.MaxLifetimeMs == 0 {
+		p.MinLifetimeMs, p.MaxLifetimeMs = defaultMinLifetimeMs, defaultMaxLifetimeMs
+	}
+	if p.MaxLifetimeMs < p.MinLifetimeMs {
+		p.MaxLifetimeMs = p.MinLifetimeMs
+	}
+	return p
+}
+
+// validate checks that the policy fits on a board with the given number of cells
+func (p SpawnPolicy) validate(cells int) error {
+	if p.Moles < 1 || p.Rabbits < 0 {
+		return fmt.Errorf("%w: spawn needs at least one mole and no negative rabbits", ErrorInvalidArguments)
+	}
+	if p.MaxMoles+p.MaxRabbits > cells {
+		return fmt.Errorf("%w: %d moles and %d rabbits do not fit on %d cells", ErrorInvalidArguments, p.MaxMoles, p.MaxRabbits, cells)
+	}
+	for _, idx := range p.HotCells {
+		if idx < 0 || idx >= cells {
+			return fmt.Errorf("%w: hot cell %d is not on the board", ErrorInvalidArguments, idx)
+		}
+	}
+	if p.MinLifetimeMs < minLifetimeMs {
+		return fmt.Errorf("%w: targets must stay at least %d ms", ErrorInvalidArguments, minLifetimeMs)
+	}
+	if err := p.validateSpecials(); err != nil {
+		return err
+	}
+	_, err := newSpawner(p)
+	return err
+}
+
+// counts returns how many moles and rabbits to spawn at progress, which goes
+// from 0 at the start of the game to 1 when the timer runs out
+func (p SpawnPolicy) counts(progress float64) (int, int) {
+	if progress < 0 {
+		progress = 0
+	}
+	if progress > 1 {
+		progress = 1
+	}
+	moles := p.Moles + int(float64(p.MaxMoles-p.Moles)*progress)
+	rabbits := p.Rabbits + int(float64(p.MaxRabbits-p.Rabbits)*progress)
+	return moles, rabbits
+}
+
+// lifetime picks how long a target spawned at progress stays on the board.
+// The longest lifetime shrinks to MinLifetimeMs as the game goes on
+func (p SpawnPolicy) lifetime(rng *rand.Rand, progress float64) time.Duration {
+	if progress < 0 {
+		progress = 0
+	}
+	if progress > 1 {
+		progress = 1
+	}
+	longest := p.MaxLifetimeMs - int64(float64(p.MaxLifetimeMs-p.MinLifetimeMs)*progress)
+	return time.Duration(p.MinLifetimeMs+rng.Int63n(longest-p.MinLifetimeMs+1)) * time.Millisecond
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSpawnPolicyRampsUp(t *testing.T) {
+	t.Parallel()
+	policy := SpawnPolicy{Moles: 1, Rabbits: 1, MaxMoles: 5, MaxRabbits: 3}
+	cases := map[float64][2]int{0: {1, 1}, 0.5: {3, 2}, 1: {5, 3}, 2: {5, 3}}
+	for progress, want := range cases {
+		if moles, rabbits := policy.counts(progress); moles != want[0] || rabbits != want[1] {
+			t.Errorf("progress %v: want %v, got [%d %d]", progress, want, moles, rabbits)
+		}
+	}
+}
+
+func TestSpawnPolicyLifetimeShrinks(t *testing.T) {
+	t.Parallel()
+	policy := defaultSpawnPolicy
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		early := policy.lifetime(rng, 0)
+		if early < 400*time.Millisecond || early > 1500*time.Millisecond {
+			t.Fatalf("want lifetime within 400-1500ms, got %v", early)
+		}
+		if late := policy.lifetime(rng, 1); late != 400*time.Millisecond {
+			t.Fatalf("want 400ms lifetime at the end, got %v", late)
+		}
+	}
+}
+
+func TestSpawnersNoOverlap(t *testing.T) {
+	t.Parallel()
+	board, _ := emptyBoard(4, 4)
+	board[0][0], board[3][3] = MoleCell, RabbitCell
+	spawners := []Spawner{UniformSpawner{}, &AvoidPreviousSpawner{}, WaveSpawner{}, HotCellSpawner{HotCells: []int{0, 5}}}
+	for _, spawner := range spawners {
+		moleCells, rabbitCells := spawner.Spawn(rand.New(rand.NewSource(1)), board, 1, 6, 10)
+		if len(moleCells) != 6 || len(rabbitCells) != 8 {
+			t.Errorf("%T: want 6 moles and 8 rabbits on the free cells, got %v %v", spawner, moleCells, rabbitCells)
+		}
+		seen := map[int]bool{0: true, 15: true}
+		for _, idx := range append(moleCells, rabbitCells...) {
+			if seen[idx] {
+				t.Errorf("%T: cell %d picked twice or already taken", spawner, idx)
+			}
+			seen[idx] = true
+		}
+	}
+}
+
+func TestAvoidPreviousSpawner(t *testing.T) {
+	t.Parallel()
+	board, _ := emptyBoard(3, 3)
+	spawner := &AvoidPreviousSpawner{}
+	for i := 0; i < 20; i++ {
+		rng := rand.New(rand.NewSource(int64(i)))
+		firstMoles, firstRabbits := spawner.Spawn(rng, board, i, 2, 2)
+		previous := map[int]bool{}
+		for _, idx := range append(firstMoles, firstRabbits...) {
+			previous[idx] = true
+		}
+		moleCells, rabbitCells := spawner.Spawn(rng, board, i, 2, 2)
+		for _, idx := range append(moleCells, rabbitCells...) {
+			if previous[idx] {
+				t.Fatalf("want previous cells avoided, got %d again", idx)
+			}
+		}
+	}
+}
+
+func TestWaveSpawnerSweepsRows(t *testing.T) {
+	t.Parallel()
+	board, _ := emptyBoard(3, 3)
+	moleCells, _ := WaveSpawner{}.Spawn(rand.New(rand.NewSource(1)), board, 1, 3, 0)
+	for _, idx := range moleCells {
+		if idx/3 != 1 {
+			t.Errorf("want moles in row 1, got cells %v", moleCells)
+		}
+	}
+}
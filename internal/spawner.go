@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Spawner decides which cells new moles and rabbits appear in. The game
+// consults its spawner whenever targets leave the board and need replacing
+type Spawner interface {
+	// Spawn returns the cells of the new moles and rabbits, all distinct and
+	// empty on board. All randomness must come from rng so that games can be
+	// replayed from their seed
+	Spawn(rng *rand.Rand, board [][]int, round int, moles int, rabbits int) (moleCells []int, rabbitCells []int)
+}
+
+// Built-in spawn strategies, selected with SpawnPolicy.Strategy
+const (
+	SpawnUniform       = "uniform"
+	SpawnAvoidPrevious = "avoidPrevious"
+	SpawnWaves         = "waves"
+	SpawnHotCells      = "hotCells"
+)
+
+// Hot cells are this many times more likely to get a mole than other cells
+const hotCellWeight = 5
+
+func newSpawner(policy SpawnPolicy) (Spawner, error) {
+	switch policy.Strategy {
+	case "", SpawnUniform:
+		return UniformSpawner{}, nil
+	case SpawnAvoidPrevious:
+		return &AvoidPreviousSpawner{}, nil
+	case SpawnWaves:
+		return WaveSpawner{}, nil
+	case SpawnHotCells:
+		return HotCellSpawner{HotCells: policy.HotCells}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown spawn strategy %q", ErrorInvalidArguments, policy.Strategy)
+	}
+}
+
+// placeTargets picks mole cells in moleOrder and rabbit cells in rabbitOrder,
+// skipping cells that are taken on board. Both orders must list every cell
+// of the board
+func placeTargets(board [][]int, moleOrder []int, rabbitOrder []int, moles int, rabbits int) ([]int, []int) {
+	cols := len(board[0])
+	taken := map[int]bool{}
+	pick := func(order []int, count int) []int {
+		cells := []int{}
+		for _, idx := range order {
+			if len(cells) >= count {
+				break
+			}
+			if !taken[idx] && board[idx/cols][idx%cols] == EmptyCell {
+				taken[idx] = true
+				cells = append(cells, idx)
+			}
+		}
+		return cells
+	}
+	moleCells := pick(moleOrder, moles)
+	return moleCells, pick(rabbitOrder, rabbits)
+}
+
+// UniformSpawner picks every cell with the same probability
+type UniformSpawner struct{}
+
+func (UniformSpawner) Spawn(rng *rand.Rand, board [][]int, round int, moles int, rabbits int) ([]int, []int) {
+	order := rng.Perm(len(board) * len(board[0]))
+	return placeTargets(board, order, order, moles, rabbits)
+}
+
+// AvoidPreviousSpawner does not reuse the cells it picked last time unless
+// the board is too small to avoid them. Each game needs its own instance
+type AvoidPreviousSpawner struct {
+	previous map[int]bool
+}
+
+func (a *AvoidPreviousSpawner) Spawn(rng *rand.Rand, board [][]int, round int, moles int, rabbits int) ([]int, []int) {
+	order := rng.Perm(len(board) * len(board[0]))
+	sort.SliceStable(order, func(i, j int) bool {
+		return !a.previous[order[i]] && a.previous[order[j]]
+	})
+	moleCells, rabbitCells := placeTargets(board, order, order, moles, rabbits)
+	a.previous = map[int]bool{}
+	for _, idx := range append(append([]int{}, moleCells...), rabbitCells...) {
+		a.previous[idx] = true
+	}
+	return moleCells, rabbitCells
+}
+
+// WaveSpawner sweeps the moles across the board, one row per round from top
+// to bottom and then one column per round from left to right
+type WaveSpawner struct{}
+
+func (WaveSpawner) Spawn(rng *rand.Rand, board [][]int, round int, moles int, rabbits int) ([]int, []int) {
+	rows, cols := len(board), len(board[0])
+	step := round % (rows + cols)
+	inWave := func(idx int) bool {
+		if step < rows {
+			return idx/cols == step
+		}
+		return idx%cols == step-rows
+	}
+	moleOrder := rng.Perm(rows * cols)
+	sort.SliceStable(moleOrder, func(i, j int) bool {
+		return inWave(moleOrder[i]) && !inWave(moleOrder[j])
+	})
+	return placeTargets(board, moleOrder, rng.Perm(rows*cols), moles, rabbits)
+}
+
+// HotCellSpawner favours a few cells for moles, rabbits are spread evenly
+type HotCellSpawner struct {
+	// Indexes of the favoured cells
+	HotCells []int
+}
+
+func (h HotCellSpawner) Spawn(rng *rand.Rand, board [][]int, round int, moles int, rabbits int) ([]int, []int) {
+	cells := len(board) * len(board[0])
+	weights := make([]int, cells)
+	for i := range weights {
+		weights[i] = 1
+	}
+	for _, idx := range h.HotCells {
+		if idx >= 0 && idx < len(weights) {
+			weights[idx] = hotCellWeight
+		}
+	}
+	// Weighted sampling without replacement, one cell at a time
+	moleOrder := []int{}
+	remaining := rng.Perm(cells)
+	for len(remaining) > 0 {
+		total := 0
+		for _, idx := range remaining {
+			total += weights[idx]
+		}
+		pick := rng.Intn(total)
+		for i, idx := range remaining {
+			pick -= weights[idx]
+			if pick < 0 {
+				moleOrder = append(moleOrder, idx)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	return placeTargets(board, moleOrder, rng.Perm(cells), moles, rabbits)
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"time"
+)
+
+const (
+	// How often the engine checks for expired targets and resolves hits.
+	// Independent of how long targets stay on the board
+	engineTick = 50 * time.Millisecond
+
+	// Boards are pushed on every change, and at least this often so clients
+	// can show the time left
+	boardRefreshInterval = time.Second
+)
+
+// DespawnReason tells clients why a target left the board
+type DespawnReason string
+
+const (
+	DespawnHit     DespawnReason = "hit"
+	DespawnExpired DespawnReason = "expired"
+	// The board was cleared, e.g. for a tiebreak
+	DespawnCleared DespawnReason = "cleared"
+)
+
+// target is a single mole, rabbit or other TargetType on the board. Each
+// target has its own lifetime, a zero expiresAt means it stays until hit
+type target struct {
+	id   int
+	cell int
+	// Cell of the TargetType
+	kind      int
+	spawnedAt time.Time
+	expiresAt time.Time
+	// First player to hit a claimable target
+	claimedBy string
+	// Players who already hit this target, each player hits a target once
+	hitBy map[string]bool
+}
+
+func (t *target) expired(now time.Time) bool {
+	return !t.expiresAt.IsZero() && !now.Before(t.expiresAt)
+}
+
+// spawnTarget puts a new target on an empty cell and tells every client
+func (g *Game) spawnTarget(cell int, kind int, lifetime time.Duration) *target {
+	g.lastTargetId += 1
+	now := time.Now()
+	t := &target{id: g.lastTargetId, cell: cell, kind: kind, spawnedAt: now, hitBy: map[string]bool{}}
+	if lifetime > 0 {
+		t.expiresAt = now.Add(lifetime)
+	}
+	g.targets = append(g.targets, t)
+	g.boardChanged = true
+	g.broadcast(MessageSpawn, SpawnMessage{
+		Target:      t.id,
+		Cell:        cell,
+		Key:         g.keys[cell],
+		Kind:        kind,
+		Marker:      targetTypes[kind].Marker,
+		LifetimeMs:  lifetime.Milliseconds(),
+		SpawnedAtMs: now.Sub(g.startTime).Milliseconds(),
+	})
+	return t
+}
+
+// despawnTarget takes a target off the board and tells every client why
+func (g *Game) despawnTarget(t *target, reason DespawnReason) {
+	targets := []*target{}
+	for _, other := range g.targets {
+		if other != t {
+			targets = append(targets, other)
+		}
+	}
+	g.targets = targets
+	g.boardChanged = true
+	g.broadcast(MessageDespawn, DespawnMessage{Target: t.id, Cell: t.cell, Key: g.keys[t.cell], Reason: reason, HitBy: t.claimedBy})
+}
+
+// clearTargets takes every target off the board
+func (g *Game) clearTargets(reason DespawnReason) {
+	for _, t := range append([]*target{}, g.targets...) {
+		g.despawnTarget(t, reason)
+	}
+}
+
+// despawnExpired takes every target whose lifetime is over off the board
+func (g *Game) despawnExpired(now time.Time) {
+	for _, t := range append([]*target{}, g.targets...) {
+		if t.expired(now) {
+			g.despawnTarget(t, DespawnExpired)
+		}
+	}
+}
+
+// liveTarget returns the target that was in cell at ts, nil if the cell was
+// empty then
+func (g *Game) liveTarget(cell int, ts time.Time) *target {
+	for _, t := range g.targets {
+		if t.cell == cell && !ts.Before(t.spawnedAt) && !t.expired(ts) {
+			return t
+		}
+	}
+	return nil
+}
+
+// countTargets returns how many targets counted against slot, MoleCell or
+// RabbitCell, are on the board
+func (g *Game) countTargets(slot int) int {
+	count := 0
+	for _, t := range g.targets {
+		if targetTypes[t.kind].SpawnsAs == slot {
+			count += 1
+		}
+	}
+	return count
+}
+
+// spawnTargets tops the board up to the number of moles and rabbits the spawn
+// policy asks for at progress
+func (g *Game) spawnTargets(progress float64) {
+	moles, rabbits := g.spawn.counts(progress)
+	moles -= g.countTargets(MoleCell)
+	rabbits -= g.countTargets(RabbitCell)
+	if moles <= 0 && rabbits <= 0 {
+		return
+	}
+	g.syncBoard()
+	moleCells, rabbitCells := g.spawner.Spawn(g.rng, g.board.Board, g.board.Round+1, moles, rabbits)
+	for _, cell := range moleCells {
+		g.spawnTarget(cell, g.spawn.pickKind(g.rng, MoleCell), g.spawn.lifetime(g.rng, progress))
+	}
+	for _, cell := range rabbitCells {
+		g.spawnTarget(cell, g.spawn.pickKind(g.rng, RabbitCell), g.spawn.lifetime(g.rng, progress))
+	}
+}
+
+// syncBoard rebuilds Board and BoardState from the live targets
+func (g *Game) syncBoard() {
+	board, boardState := emptyBoard(g.rows, g.cols)
+	for _, t := range g.targets {
+		board[t.cell/g.cols][t.cell%g.cols] = t.kind
+		boardState[t.cell] = targetTypes[t.kind].Marker
+	}
+	g.board.Board = board
+	g.board.BoardState = boardState
+}
+
+// publishBoard pushes the board to every client if it changed since the last
+// push, or if the last push is older than boardRefreshInterval
+func (g *Game) publishBoard(now time.Time) {
+	if !g.boardChanged && now.Sub(g.lastPublish) < boardRefreshInterval {
+		return
+	}
+	if g.boardChanged {
+		g.syncBoard()
+		g.board.Round += 1
+	}
+	g.broadcast(MessageBoard, g.board)
+	g.boardChanged = false
+	g.lastPublish = now
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// TargetType describes how a kind of target shows up on the board and what
+// hitting it does to the player
+type TargetType struct {
+	Name string
+	// Value in GameBoard.Board
+	Cell int
+	// Value in GameBoard.BoardState
+	Marker string
+	// Points and health gained by the hitter, negative to lose them. Health
+	// never goes above the starting health of the room
+	Score  int64
+	Health int64
+	// The first player to hit the target claims it and takes it off the
+	// board, otherwise every player can hit it once
+	Claimable bool
+	// How long the other players cannot hit anything after it is hit
+	FreezeMs int64
+	// Spawn policy count the type belongs to, MoleCell or RabbitCell. Zero
+	// for targets the game places itself
+	SpawnsAs int
+	// Percent chance that a target spawned for SpawnsAs becomes this type
+	// instead, SpawnPolicy.Specials overrides it per room
+	Chance int
+}
+
+// Cell values of the built-in special targets, after EmptyCell, MoleCell,
+// RabbitCell and SuperMoleCell
+const (
+	GoldenMoleCell = SuperMoleCell + 1 + iota
+	BombCell
+	HeartCell
+	FreezeCell
+)
+
+var targetTypes = map[int]TargetType{}
+
+// RegisterTargetType makes a target type available under its Cell.
+// Registering the same Cell twice replaces the previous type
+func RegisterTargetType(targetType TargetType) {
+	targetTypes[targetType.Cell] = targetType
+}
+
+// TargetTypeOf returns the type of target shown as cell in GameBoard.Board
+func TargetTypeOf(cell int) (TargetType, bool) {
+	targetType, ok := targetTypes[cell]
+	return targetType, ok
+}
+
+func init() {
+	RegisterTargetType(TargetType{Name: "mole", Cell: MoleCell, Marker: "m", Score: 1, Claimable: true, SpawnsAs: MoleCell})
+	RegisterTargetType(TargetType{Name: "rabbit", Cell: RabbitCell, Marker: "r", Health: -1, SpawnsAs: RabbitCell})
+	RegisterTargetType(TargetType{Name: "superMole", Cell: SuperMoleCell, Marker: "s", Claimable: true})
+	RegisterTargetType(TargetType{Name: "goldenMole", Cell: GoldenMoleCell, Marker: "g", Score: 5, Claimable: true, SpawnsAs: MoleCell, Chance: 10})
+	RegisterTargetType(TargetType{Name: "bomb", Cell: BombCell, Marker: "b", Health: -3, SpawnsAs: RabbitCell, Chance: 10})
+	RegisterTargetType(TargetType{Name: "heart", Cell: HeartCell, Marker: "h", Health: 1, Claimable: true, SpawnsAs: MoleCell, Chance: 5})
+	RegisterTargetType(TargetType{Name: "freeze", Cell: FreezeCell, Marker: "f", Claimable: true, FreezeMs: 1500, SpawnsAs: MoleCell, Chance: 5})
+}
+
+// specialTypes returns the types that can replace targets spawned for slot,
+// in Cell order so the same seed picks the same types
+func specialTypes(slot int) []TargetType {
+	specials := []TargetType{}
+	for cell, targetType := range targetTypes {
+		if targetType.SpawnsAs == slot && cell != slot {
+			specials = append(specials, targetType)
+		}
+	}
+	sort.Slice(specials, func(i, j int) bool {
+		return specials[i].Cell < specials[j].Cell
+	})
+	return specials
+}
+
+// chance returns how likely targetType replaces a target in rooms using p
+func (p SpawnPolicy) chance(targetType TargetType) int {
+	if chance, ok := p.Specials[targetType.Name]; ok {
+		return chance
+	}
+	return targetType.Chance
+}
+
+// validateSpecials checks that every special is known and that the chances
+// of replacing a mole or a rabbit do not add up to more than 100 percent
+func (p SpawnPolicy) validateSpecials() error {
+	known := map[string]bool{}
+	for _, slot := range []int{MoleCell, RabbitCell} {
+		total := 0
+		for _, targetType := range specialTypes(slot) {
+			known[targetType.Name] = true
+			total += p.chance(targetType)
+		}
+		if total > 100 {
+			return fmt.Errorf("%w: special chances for %s add up to %d percent", ErrorInvalidArguments, targetTypes[slot].Name, total)
+		}
+	}
+	for name, chance := range p.Specials {
+		if !known[name] {
+			return fmt.Errorf("%w: unknown special target %q", ErrorInvalidArguments, name)
+		}
+		if chance < 0 {
+			return fmt.Errorf("%w: chance of %s cannot be negative", ErrorInvalidArguments, name)
+		}
+	}
+	return nil
+}
+
+// pickKind decides which type of target to spawn for slot
+func (p SpawnPolicy) pickKind(rng *rand.Rand, slot int) int {
+	roll := rng.Intn(100)
+	for _, targetType := range specialTypes(slot) {
+		chance := p.chance(targetType)
+		if roll < chance {
+			return targetType.Cell
+		}
+		roll -= chance
+	}
+	return slot
+}
@@ -30,3 +30,14 @@ func contains(s []string, str string) bool {
 
 	return false
 }
+
+// remove returns s without any occurrence of str
+func remove(s []string, str string) []string {
+	result := []string{}
+	for _, v := range s {
+		if v != str {
+			result = append(result, v)
+		}
+	}
+	return result
+}